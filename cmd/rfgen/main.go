@@ -0,0 +1,73 @@
+// Command rfgen generates the Go record types of recordfile tables, with
+// their indexes and typed accessors, and the matching C# classes.
+//
+//	rfgen -pkg data -o data/tables.go -cs Client/Tables.cs item.txt drop.xlsx
+//
+// See gen.Table for the type row of the tables.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/zfiona/server-base/recordfile"
+	"github.com/zfiona/server-base/recordfile/gen"
+	"os"
+	"unicode/utf8"
+)
+
+func main() {
+	pkg := flag.String("pkg", "data", "package of the Go file")
+	out := flag.String("o", "", "Go file, stdout if empty")
+	cs := flag.String("cs", "", "C# file, none if empty")
+	namespace := flag.String("ns", "Data", "namespace of the C# file")
+	comma := flag.String("comma", string(recordfile.Comma), "field separator of text tables")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: rfgen [flags] table...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	r, _ := utf8.DecodeRuneInString(*comma)
+	if flag.NArg() == 0 || utf8.RuneCountInString(*comma) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var tables []*gen.Table
+	failed := false
+	for _, name := range flag.Args() {
+		t, err := gen.ReadTable(name, r)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		tables = append(tables, t)
+	}
+	if failed {
+		os.Exit(1)
+	}
+
+	src, err := gen.GoSource(*pkg, tables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *cs != "" {
+		err = os.WriteFile(*cs, gen.CSharpSource(*namespace, tables), 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
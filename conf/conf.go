@@ -1,9 +1,46 @@
 package conf
 
+import (
+	"time"
+)
+
 var (
 	LenStackBuf = 4096
 
+	// how long module.Destroy waits for a module to stop, 0 means no limit
+	ModuleShutdownTimeout time.Duration
+	// how long module.Command.Exec waits for the module, 0 means no limit
+	CommandTimeout = 10 * time.Second
+
 	LogLevel string
 	LogPath  string
 	LogFlag  int
+	// the prefix of the log files, the program name if empty: processes
+	// sharing LogPath need different names
+	LogName string
+	// text, json or logfmt
+	LogFormat string
+	// rotation: by size in megabytes (0 means no limit) and hourly or daily
+	LogMaxSize int
+	LogRotate  string
+	// retention of rotated files: gzip, count and age (0 means no limit)
+	LogCompress   bool
+	LogMaxBackups int
+	LogMaxAge     time.Duration
+	// async writing through a buffer of LogAsyncSize entries (0 means sync),
+	// when full: block, dropdebug or drop
+	LogAsyncSize   int
+	LogAsyncPolicy string
+	// also to stdout when LogPath is set
+	LogStdout bool
+	// also to a collector: tcp or udp, as lines or syslog messages
+	LogNetwork  string
+	LogAddr     string
+	LogNetLevel string
+	LogSyslog   bool
+
+	// console, disabled when ConsolePort is 0
+	ConsolePort   int
+	ConsolePrompt = "Server# "
+	ProfilePath   string
 )
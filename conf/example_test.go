@@ -0,0 +1,104 @@
+package conf_test
+
+import (
+	"fmt"
+	"github.com/zfiona/server-base/conf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func ExampleLoader() {
+	type Config struct {
+		Gate struct {
+			Addr    string `conf:"addr,required"`
+			MaxConn int    `conf:"maxConn" default:"1000"`
+		} `conf:"gate"`
+		DB struct {
+			Addr     string `conf:"addr,required"`
+			Password string `conf:"password,required"`
+			Replicas []string
+		} `conf:"db"`
+		Timeout time.Duration `conf:"timeout" default:"5s"`
+		Debug   bool          `conf:"debug"`
+	}
+
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// shared settings, then the ones of the environment
+	base := filepath.Join(dir, "server.yaml")
+	ioutil.WriteFile(base, []byte(`
+gate:
+  addr: 127.0.0.1:3563
+db:
+  addr: 127.0.0.1:3306
+  replicas: [10.0.0.2:3306]
+`), 0644)
+	prod := filepath.Join(dir, "prod.toml")
+	ioutil.WriteFile(prod, []byte(`
+timeout = "10s"
+
+[db]
+addr = "10.0.0.1:3306"
+`), 0644)
+
+	os.Setenv("SERVER_DB_PASSWORD", "secret")
+	defer os.Unsetenv("SERVER_DB_PASSWORD")
+
+	var c Config
+	l := conf.Loader{
+		EnvPrefix: "SERVER",
+		Args:      []string{"-gate.maxConn=5000", "-debug"},
+	}
+	err = l.Load(&c, base, prod)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(c.Gate.Addr, c.Gate.MaxConn)
+	fmt.Println(c.DB.Addr, c.DB.Password, c.DB.Replicas)
+	fmt.Println(c.Timeout, c.Debug)
+
+	// all the problems at once
+	bad := filepath.Join(dir, "bad.json")
+	ioutil.WriteFile(bad, []byte(`{
+		"gate": {"maxConn": "many", "port": 3563},
+		"timeout": 10
+	}`), 0644)
+
+	var c2 Config
+	l = conf.Loader{Args: []string{"-config", bad, "-db.addr", "127.0.0.1:3306", "-test.v=true"}}
+	err = l.Load(&c2, bad)
+	fmt.Println(strings.ReplaceAll(err.Error(), dir, "dir"))
+
+	// Output:
+	// 127.0.0.1:3563 5000
+	// 10.0.0.1:3306 secret [10.0.0.2:3306]
+	// 10s true
+	// conf: 5 problem(s):
+	// dir/bad.json: gate.maxConn: strconv.ParseInt: parsing "many": invalid syntax
+	// dir/bad.json: gate.port: unknown key
+	// dir/bad.json: timeout: a duration must be a string such as 5s
+	// gate.addr: required
+	// db.password: required
+}
+
+func ExampleLoad() {
+	var c struct {
+		Addr    string `conf:"addr" default:"127.0.0.1:3563"`
+		MaxConn int    `conf:"maxConn" default:"1000"`
+	}
+
+	// the flags of go test are skipped
+	err := conf.Load(&c)
+	fmt.Println(c.Addr, c.MaxConn, err)
+
+	// Output:
+	// 127.0.0.1:3563 1000 <nil>
+}
@@ -0,0 +1,69 @@
+package live_test
+
+import (
+	"fmt"
+	"github.com/zfiona/server-base/chanrpc"
+	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/conf/live"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func ExampleConfig() {
+	type Config struct {
+		Addr   string `conf:"addr,static"`
+		Limits struct {
+			Rate  int `conf:"rate"`
+			Burst int `conf:"burst"`
+		} `conf:"limits"`
+		LogLevel string `conf:"logLevel"`
+		Gate     struct {
+			MaxConn int `conf:"maxConn"`
+		} `conf:"gate,static"`
+	}
+
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "server.yaml")
+	ioutil.WriteFile(name, []byte(`
+addr: 127.0.0.1:3563
+limits: {rate: 100, burst: 10}
+logLevel: release
+gate: {maxConn: 1000}
+`), 0644)
+
+	c, err := live.New[Config](conf.Loader{}, name)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// a module, busy during the reload
+	s := chanrpc.NewServer(0)
+	s.Register("LimitsChanged", func(args []interface{}) {
+		fmt.Println(args[0].(string), "changed to", args[1].(int))
+	})
+	c.Subscribe(s, "LimitsChanged", "limits")
+
+	ioutil.WriteFile(name, []byte(`
+addr: 0.0.0.0:3563
+limits: {rate: 200, burst: 10}
+logLevel: debug
+gate: {maxConn: 2000}
+`), 0644)
+	err = live.Reload()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	s.Exec(<-s.ChanCall)
+	fmt.Println(c.Get().Addr, c.Get().Limits.Rate, c.Get().LogLevel, c.Get().Gate.MaxConn)
+
+	// Output:
+	// limits.rate changed to 200
+	// 127.0.0.1:3563 200 debug 1000
+}
@@ -0,0 +1,162 @@
+package live
+
+import (
+	"errors"
+	"github.com/zfiona/server-base/chanrpc"
+	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/log"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Config a configuration loaded by a conf.Loader and reloaded by Reload, on
+// SIGHUP or by the console command reload. A reload replaces the current
+// version as a whole, Get returns either version: do not modify it.
+// The changes of static fields are ignored with a warning
+type Config[T any] struct {
+	loader      conf.Loader
+	files       []string
+	v           atomic.Pointer[T]
+	mutexReload sync.Mutex
+	mutex       sync.Mutex
+	subscribers []subscriber
+	// closed once the subscribers know the changes of the last reload
+	notified chan struct{}
+}
+
+type subscriber struct {
+	server *chanrpc.Server
+	id     interface{}
+	keys   []string
+}
+
+var (
+	mutex   sync.Mutex
+	configs []interface{ Reload() error }
+)
+
+// New goroutine safe
+// loads the configuration from the files as loader.Load
+func New[T any](loader conf.Loader, files ...string) (*Config[T], error) {
+	v := new(T)
+	err := loader.Load(v, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config[T])
+	c.loader = loader
+	c.files = files
+	c.v.Store(v)
+
+	mutex.Lock()
+	configs = append(configs, c)
+	mutex.Unlock()
+
+	return c, nil
+}
+
+// Get goroutine safe
+func (c *Config[T]) Get() *T {
+	return c.v.Load()
+}
+
+// Subscribe goroutine safe
+// the function id of server is called with the path and the new value of
+// each changed field under keys, a path or its prefix such as "gate" for
+// "gate.maxConn", all the fields if none: func(args []interface{}) with
+// args[0].(string) and args[1] of the type of the field
+func (c *Config[T]) Subscribe(server *chanrpc.Server, id interface{}, keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.subscribers = append(c.subscribers, subscriber{server, id, keys})
+}
+
+func (s *subscriber) match(path string) bool {
+	if len(s.keys) == 0 {
+		return true
+	}
+	for _, key := range s.keys {
+		if path == key || strings.HasPrefix(path, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload goroutine safe
+// loads the configuration again and notifies the subscribers of the changes,
+// the current version is kept on error. The subscribers are notified on a
+// goroutine, in order of the reloads: Reload does not wait for busy modules
+func (c *Config[T]) Reload() error {
+	c.mutexReload.Lock()
+	defer c.mutexReload.Unlock()
+
+	v := new(T)
+	err := c.loader.Load(v, c.files...)
+	if err != nil {
+		return err
+	}
+
+	var changed []conf.Field
+	oldFields := conf.Fields(c.v.Load())
+	for i, f := range conf.Fields(v) {
+		old := oldFields[i].Value
+		if reflect.DeepEqual(old.Interface(), f.Value.Interface()) {
+			continue
+		}
+		if f.Static {
+			log.Error("conf: %v is static, change from %v to %v ignored",
+				f.Path, old.Interface(), f.Value.Interface())
+			f.Value.Set(old)
+			continue
+		}
+		changed = append(changed, f)
+	}
+	c.v.Store(v)
+	log.Release("conf reloaded, %v change(s)", len(changed))
+
+	c.mutex.Lock()
+	subscribers := c.subscribers
+	c.mutex.Unlock()
+
+	prev := c.notified
+	done := make(chan struct{})
+	c.notified = done
+	go func() {
+		defer close(done)
+		if prev != nil {
+			<-prev
+		}
+
+		for _, f := range changed {
+			for i := range subscribers {
+				s := &subscribers[i]
+				if s.match(f.Path) {
+					s.server.Go(s.id, f.Path, f.Value.Interface())
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Reload goroutine safe
+// reloads all the configurations created by New
+func Reload() error {
+	mutex.Lock()
+	cs := configs
+	mutex.Unlock()
+
+	var errs []error
+	for _, c := range cs {
+		err := c.Reload()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,549 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Loader fills a struct from configuration files, then from environment
+// variables and command-line flags. The fields are named by their path:
+//
+//	type Config struct {
+//		Gate struct {
+//			Addr    string `conf:"addr,required"`
+//			MaxConn int    `default:"1000"`
+//		}
+//		DB      DBConfig `conf:"db"`
+//		Timeout time.Duration `default:"5s"`
+//	}
+//
+// gate.addr is set by {"gate": {"addr": ...}} in a file, by the variable
+// PREFIX_GATE_ADDR and by the flag -gate.addr=... Names match regardless of
+// case. Arrays, slices, maps and structs are JSON in variables and flags.
+// A required field must be set by a file, a variable or a flag, or be in its
+// element of an array, a slice or a map. A default is the value of a field
+// not set. All the problems are reported at once.
+// A static field, conf:"name,static", is not changed by a reload, see
+// conf/live. The fields of a static struct are static
+type Loader struct {
+	// the prefix of the variables, no variable is read if empty
+	EnvPrefix string
+	// the flags: -path=value, -path value or -path for true. The flags of no
+	// field are skipped, they may be those of the program or of go test
+	Args []string
+}
+
+// Load fills v, a pointer to a struct, from the files in order, the later ones
+// override: .json, .yaml, .yml or .toml. The flags are os.Args[1:], those of
+// no field are skipped
+func Load(v interface{}, files ...string) error {
+	l := Loader{Args: os.Args[1:]}
+	return l.Load(v, files...)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type leaf struct {
+	path     string
+	value    reflect.Value
+	required bool
+	static   bool
+	def      string
+	hasDef   bool
+}
+
+type loadState struct {
+	problems []error
+	set      map[string]bool
+}
+
+// problem source: path: err, without the empty parts
+func (s *loadState) problem(source, path string, err interface{}) {
+	msg := fmt.Sprint(err)
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	if source != "" {
+		msg = source + ": " + msg
+	}
+	s.problems = append(s.problems, errors.New(msg))
+}
+
+func (l *Loader) Load(v interface{}, files ...string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("v must be a pointer to a struct")
+	}
+	root := rv.Elem()
+
+	s := &loadState{set: make(map[string]bool)}
+	leaves := leavesOf(root, "", false)
+
+	// defaults
+	for _, f := range leaves {
+		if !f.hasDef {
+			continue
+		}
+		err := setString(f.value, f.def)
+		if err != nil {
+			s.problem("default", f.path, err)
+		}
+	}
+
+	// files
+	for _, name := range files {
+		m, err := readFile(name)
+		if err != nil {
+			s.problem(name, "", err)
+			continue
+		}
+		s.assignStruct(name, "", root, m, false)
+	}
+
+	// environment
+	if l.EnvPrefix != "" {
+		for _, f := range leaves {
+			env := envName(l.EnvPrefix, f.path)
+			value, ok := os.LookupEnv(env)
+			if !ok {
+				continue
+			}
+			err := setString(f.value, value)
+			if err != nil {
+				s.problem("env "+env, f.path, err)
+				continue
+			}
+			s.set[f.path] = true
+		}
+	}
+
+	// flags
+	byPath := make(map[string]*leaf, len(leaves))
+	for i := range leaves {
+		byPath[strings.ToLower(leaves[i].path)] = &leaves[i]
+	}
+	for i := 0; i < len(l.Args); i++ {
+		arg := l.Args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		value, hasValue := "", false
+		if j := strings.IndexByte(name, '='); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		f, ok := byPath[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		if !hasValue {
+			if f.value.Kind() == reflect.Bool {
+				value = "true"
+			} else if i+1 < len(l.Args) {
+				i++
+				value = l.Args[i]
+			} else {
+				s.problem("flag -"+name, "", "missing value")
+				continue
+			}
+		}
+		err := setString(f.value, value)
+		if err != nil {
+			s.problem("flag -"+name, "", err)
+			continue
+		}
+		s.set[f.path] = true
+	}
+
+	// required
+	for _, f := range leaves {
+		if f.required && !s.set[f.path] {
+			s.problem(f.path, "", "required")
+		}
+	}
+
+	if len(s.problems) > 0 {
+		return fmt.Errorf("conf: %v problem(s):\n%w", len(s.problems), errors.Join(s.problems...))
+	}
+	return nil
+}
+
+// fieldName the name in the conf tag or the field name, "" for a skipped field
+func fieldName(f reflect.StructField) (name string, opts []string) {
+	if f.PkgPath != "" {
+		return "", nil
+	}
+	name = f.Name
+	if tag, ok := f.Tag.Lookup("conf"); ok {
+		opts = strings.Split(tag, ",")
+		if opts[0] == "-" {
+			return "", nil
+		}
+		if opts[0] != "" {
+			name = opts[0]
+		}
+		opts = opts[1:]
+	}
+	return name, opts
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// leavesOf the fields of v, nested structs flattened, all static in a static
+// struct
+func leavesOf(v reflect.Value, prefix string, static bool) []leaf {
+	var leaves []leaf
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := fieldName(f)
+		if name == "" {
+			continue
+		}
+		path := joinPath(prefix, name)
+		l := leaf{path: path, value: v.Field(i), static: static}
+		for _, opt := range opts {
+			switch opt {
+			case "required":
+				l.required = true
+			case "static":
+				l.static = true
+			}
+		}
+		if f.Type.Kind() == reflect.Struct {
+			leaves = append(leaves, leavesOf(v.Field(i), path, l.static)...)
+			continue
+		}
+
+		l.def, l.hasDef = f.Tag.Lookup("default")
+		leaves = append(leaves, l)
+	}
+	return leaves
+}
+
+// Field a field of a configuration struct
+type Field struct {
+	Path   string
+	Value  reflect.Value
+	Static bool
+}
+
+// Fields of v, a pointer to a struct, nested structs flattened, in order of
+// declaration
+func Fields(v interface{}) []Field {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		panic("v must be a pointer to a struct")
+	}
+
+	leaves := leavesOf(rv.Elem(), "", false)
+	fields := make([]Field, len(leaves))
+	for i, l := range leaves {
+		fields[i] = Field{Path: l.path, Value: l.value, Static: l.static}
+	}
+	return fields
+}
+
+func envName(prefix, path string) string {
+	name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// readFile the top-level table of a file, the format follows the extension
+func readFile(name string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&m)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &m)
+	case ".toml":
+		_, err = toml.Decode(string(data), &m)
+	default:
+		err = errors.New("unknown format")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// assignStruct the keys of m to the fields of v, unknown keys are problems.
+// The required fields of an element of an array, a slice or a map must be
+// in m
+func (s *loadState) assignStruct(source, prefix string, v reflect.Value, m map[string]interface{}, elem bool) {
+	t := v.Type()
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := fieldName(t.Field(i))
+		if name != "" {
+			fields[strings.ToLower(name)] = i
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		i, ok := fields[strings.ToLower(k)]
+		if !ok {
+			s.problem(source, joinPath(prefix, k), "unknown key")
+			continue
+		}
+		name, _ := fieldName(t.Field(i))
+		s.assign(source, joinPath(prefix, name), v.Field(i), m[k], elem)
+		delete(fields, strings.ToLower(name))
+	}
+
+	if !elem {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name, opts := fieldName(t.Field(i))
+		if _, ok := fields[strings.ToLower(name)]; !ok || name == "" {
+			continue
+		}
+		for _, opt := range opts {
+			if opt == "required" {
+				s.problem(source, joinPath(prefix, name), "required")
+			}
+		}
+	}
+}
+
+// assign a decoded value to v
+func (s *loadState) assign(source, path string, v reflect.Value, value interface{}, elem bool) {
+	switch x := value.(type) {
+	case map[interface{}]interface{}:
+		value = stringKeys(x)
+	case []map[string]interface{}:
+		values := make([]interface{}, len(x))
+		for i, m := range x {
+			values[i] = m
+		}
+		value = values
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			s.problem(source, path, fmt.Sprintf("cannot use %v as a table", value))
+			return
+		}
+		s.assignStruct(source, path, v, m, elem)
+		return
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		values, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		if v.Kind() == reflect.Array {
+			if len(values) != v.Len() {
+				s.problem(source, path, fmt.Sprintf("%v values for %v", len(values), v.Type()))
+				return
+			}
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), len(values), len(values)))
+		}
+		for i, e := range values {
+			s.assign(source, fmt.Sprintf("%v[%v]", path, i), v.Index(i), e, true)
+		}
+		s.set[path] = true
+		return
+	case v.Kind() == reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		for k, e := range m {
+			key := reflect.New(v.Type().Key()).Elem()
+			err := setString(key, k)
+			if err != nil {
+				s.problem(source, joinPath(path, k), err)
+				continue
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			s.assign(source, joinPath(path, k), value, e, true)
+			v.SetMapIndex(key, value)
+		}
+		s.set[path] = true
+		return
+	}
+
+	err := setScalar(v, value)
+	if err != nil {
+		s.problem(source, path, err)
+		return
+	}
+	s.set[path] = true
+}
+
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	sm := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		sm[fmt.Sprint(k)] = v
+	}
+	return sm
+}
+
+// setScalar a decoded number, string or bool
+func setScalar(v reflect.Value, value interface{}) error {
+	if str, ok := value.(string); ok && v.Kind() != reflect.String {
+		return setString(v, str)
+	}
+
+	mismatch := fmt.Errorf("cannot use %v (%T) as %v", value, value, v.Type())
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return mismatch
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			return errors.New("a duration must be a string such as 5s")
+		}
+		i, ok := toInt64(value)
+		if !ok || v.OverflowInt(i) {
+			return mismatch
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := toInt64(value)
+		if !ok || i < 0 || v.OverflowUint(uint64(i)) {
+			return mismatch
+		}
+		v.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(value)
+		if !ok || v.OverflowFloat(f) {
+			return mismatch
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		str, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		v.SetString(str)
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch n := value.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case float64:
+		return int64(n), n == math.Trunc(n) && math.Abs(n) < 1<<63
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	i, ok := toInt64(value)
+	return float64(i), ok
+}
+
+// setString the text of a value, JSON for arrays, slices, maps and structs
+func setString(v reflect.Value, str string) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(str, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(str, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct:
+		decoder := json.NewDecoder(strings.NewReader(str))
+		decoder.UseNumber()
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err != nil {
+			return err
+		}
+		s := &loadState{set: make(map[string]bool)}
+		s.assign("", "", v, value, true)
+		return errors.Join(s.problems...)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/conf/live"
+	"github.com/zfiona/server-base/log"
+	"github.com/zfiona/server-base/module"
+	"github.com/zfiona/server-base/network"
+	"os"
+	"path"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+type command struct {
+	name string
+	help string
+	run  func(args []string) string
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"help", "this help text", cmdHelp},
+		{"modules", "list registered modules", cmdModules},
+		{"goroutine", "dump the stacks of all goroutines", cmdGoroutine},
+		{"pprof", "write a profile to file: pprof heap|goroutine|block|mutex|threadcreate|allocs", cmdPprof},
+		{"cpuprof", "CPU profiling: cpuprof start|stop", cmdCPUProf},
+		{"loglevel", "show or change log levels: loglevel [name] [debug|release|error|fatal|inherit]", cmdLogLevel},
+		{"conns", "number of connections", cmdConns},
+		{"gc", "run a garbage collection", cmdGC},
+		{"reload", "reload the configuration", cmdReload},
+		{"quit", "exit console", nil},
+	}
+}
+
+func lookup(name string) *command {
+	for _, c := range commands {
+		if c.name == name && c.run != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func cmdHelp(args []string) string {
+	output := "Commands:\r\n"
+	for _, c := range commands {
+		output += c.name + " - " + c.help + "\r\n"
+	}
+	for _, c := range module.Commands() {
+		output += c.Name + " - " + c.Help + "\r\n"
+	}
+	return strings.TrimSuffix(output, "\r\n")
+}
+
+func cmdModules(args []string) string {
+	var lines []string
+	for i, s := range module.Statuses() {
+		line := fmt.Sprintf("%v. %v [%v]", i, s.Name, s.State)
+		if len(s.DependsOn) > 0 {
+			line += " depends on " + strings.Join(s.DependsOn, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+func cmdGoroutine(args []string) string {
+	var buf bytes.Buffer
+	err := pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	if err != nil {
+		return err.Error()
+	}
+	return strings.Replace(strings.TrimSpace(buf.String()), "\n", "\r\n", -1)
+}
+
+func profileFilename(name string) string {
+	now := time.Now()
+	return path.Join(conf.ProfilePath, fmt.Sprintf("%d%02d%02d_%02d_%02d_%02d.%v.prof",
+		now.Year(),
+		now.Month(),
+		now.Day(),
+		now.Hour(),
+		now.Minute(),
+		now.Second(),
+		name))
+}
+
+func cmdPprof(args []string) string {
+	if len(args) != 1 {
+		return "usage: pprof heap|goroutine|block|mutex|threadcreate|allocs"
+	}
+	p := pprof.Lookup(args[0])
+	if p == nil {
+		return "unknown profile: " + args[0]
+	}
+
+	filename := profileFilename(args[0])
+	f, err := os.Create(filename)
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	err = p.WriteTo(f, 0)
+	if err != nil {
+		return err.Error()
+	}
+	return filename
+}
+
+var cpuProf struct {
+	sync.Mutex
+	f *os.File
+}
+
+func cmdCPUProf(args []string) string {
+	if len(args) != 1 {
+		return "usage: cpuprof start|stop"
+	}
+
+	cpuProf.Lock()
+	defer cpuProf.Unlock()
+
+	switch args[0] {
+	case "start":
+		if cpuProf.f != nil {
+			return "cpuprof already started"
+		}
+		filename := profileFilename("cpu")
+		f, err := os.Create(filename)
+		if err != nil {
+			return err.Error()
+		}
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			f.Close()
+			return err.Error()
+		}
+		cpuProf.f = f
+		return filename
+	case "stop":
+		if cpuProf.f == nil {
+			return "cpuprof not started"
+		}
+		pprof.StopCPUProfile()
+		cpuProf.f.Close()
+		filename := cpuProf.f.Name()
+		cpuProf.f = nil
+		return filename
+	default:
+		return "usage: cpuprof start|stop"
+	}
+}
+
+func cmdLogLevel(args []string) string {
+	switch len(args) {
+	case 0:
+		lines := []string{log.Level()}
+		for _, name := range log.Names() {
+			lines = append(lines, namedLevel(name))
+		}
+		return strings.Join(lines, "\r\n")
+	case 1:
+		// a named logger, otherwise the level of all
+		if _, _, ok := log.NamedLevel(args[0]); ok {
+			return namedLevel(args[0])
+		}
+		switch strings.ToLower(args[0]) {
+		case "debug", "release", "error", "fatal":
+		default:
+			return "unknown logger or level: " + args[0]
+		}
+		err := log.SetLevel(args[0])
+		if err != nil {
+			return err.Error()
+		}
+		return log.Level()
+	case 2:
+		level := args[1]
+		if level == "inherit" {
+			level = ""
+		}
+		err := log.SetNamedLevel(args[0], level)
+		if err != nil {
+			return err.Error()
+		}
+		return namedLevel(args[0])
+	default:
+		return "usage: loglevel [name] [debug|release|error|fatal|inherit]"
+	}
+}
+
+// namedLevel name: level, (inherited) if it follows the exported logger
+func namedLevel(name string) string {
+	level, inherited, _ := log.NamedLevel(name)
+	if inherited {
+		level += " (inherited)"
+	}
+	return name + ": " + level
+}
+
+func cmdConns(args []string) string {
+	return fmt.Sprintf("%v", network.ConnNum())
+}
+
+func cmdGC(args []string) string {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	return fmt.Sprintf("HeapAlloc: %v -> %v, NumGoroutine: %v",
+		before.HeapAlloc, after.HeapAlloc, runtime.NumGoroutine())
+}
+
+func cmdReload(args []string) string {
+	err := live.Reload()
+	if err != nil {
+		return strings.Replace(err.Error(), "\n", "\r\n", -1)
+	}
+	return "ok"
+}
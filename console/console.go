@@ -0,0 +1,138 @@
+package console
+
+import (
+	"bufio"
+	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/log"
+	"github.com/zfiona/server-base/module"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Module telnet admin console, listening on localhost:conf.ConsolePort
+type Module struct {
+	ln         net.Listener
+	wg         sync.WaitGroup
+	mutexConns sync.Mutex
+	conns      map[net.Conn]struct{}
+}
+
+func (m *Module) OnInit() {
+	if conf.ConsolePort == 0 {
+		return
+	}
+
+	addr := "localhost:" + strconv.Itoa(conf.ConsolePort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+	log.Release("Launch console,%v", addr)
+
+	m.ln = ln
+	m.conns = make(map[net.Conn]struct{})
+}
+
+func (m *Module) Run(closeSig chan bool) {
+	if m.ln == nil {
+		<-closeSig
+		return
+	}
+
+	m.wg.Add(1)
+	go m.accept()
+
+	<-closeSig
+	m.ln.Close()
+
+	m.mutexConns.Lock()
+	for conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+	m.mutexConns.Unlock()
+
+	m.wg.Wait()
+}
+
+func (m *Module) OnDestroy() {}
+
+func (m *Module) accept() {
+	defer m.wg.Done()
+
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		m.mutexConns.Lock()
+		if m.conns == nil {
+			m.mutexConns.Unlock()
+			conn.Close()
+			return
+		}
+		m.conns[conn] = struct{}{}
+		m.wg.Add(1)
+		m.mutexConns.Unlock()
+
+		go m.serve(conn)
+	}
+}
+
+func (m *Module) serve(conn net.Conn) {
+	defer func() {
+		m.mutexConns.Lock()
+		delete(m.conns, conn)
+		m.mutexConns.Unlock()
+
+		conn.Close()
+		m.wg.Done()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		if _, err := conn.Write([]byte(conf.ConsolePrompt)); err != nil {
+			return
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" {
+			return
+		}
+
+		output := exec(fields)
+		if output == "" {
+			continue
+		}
+		if _, err := conn.Write([]byte(output + "\r\n")); err != nil {
+			return
+		}
+	}
+}
+
+func exec(fields []string) string {
+	if c := lookup(fields[0]); c != nil {
+		return c.run(fields[1:])
+	}
+
+	c, args := module.LookupCommand(fields)
+	if c == nil {
+		return "command not found, try `help` for help"
+	}
+	output, err := c.Exec(args)
+	if err != nil {
+		return err.Error()
+	}
+	return output
+}
@@ -0,0 +1,74 @@
+package console_test
+
+import (
+	"fmt"
+	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/console"
+	"github.com/zfiona/server-base/log"
+	"github.com/zfiona/server-base/module"
+	"io"
+	"net"
+	"strings"
+)
+
+func Example() {
+	// a free port
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	conf.ConsolePort = ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := new(console.Module)
+	m.OnInit()
+	consoleSig := make(chan bool, 1)
+	consoleDone := make(chan struct{})
+	go func() {
+		m.Run(consoleSig)
+		close(consoleDone)
+	}()
+
+	s := new(module.Skeleton)
+	s.Init()
+	s.RegisterCommand("game echo", "echo the arguments", func(args []string) string {
+		return strings.Join(args, " ")
+	})
+	skeletonSig := make(chan bool, 1)
+	skeletonDone := make(chan struct{})
+	go func() {
+		s.Run(skeletonSig)
+		close(skeletonDone)
+	}()
+
+	log.Named("gate")
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%v", conf.ConsolePort))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	conn.Write([]byte("game echo a b\r\n\r\nnosuch\r\npprof\r\ncpuprof restart\r\nloglevel a b c\r\n" +
+		"loglevel gate\r\nloglevel gate error\r\nloglevel gate\r\nloglevel nosuch\r\nloglevel gate inherit\r\nquit\r\n"))
+	out, _ := io.ReadAll(conn)
+	conn.Close()
+	fmt.Println(strings.Replace(string(out), "\r\n", "\n", -1))
+
+	skeletonSig <- true
+	<-skeletonDone
+	consoleSig <- true
+	<-consoleDone
+
+	// Output:
+	// Server# a b
+	// Server# Server# command not found, try `help` for help
+	// Server# usage: pprof heap|goroutine|block|mutex|threadcreate|allocs
+	// Server# usage: cpuprof start|stop
+	// Server# usage: loglevel [name] [debug|release|error|fatal|inherit]
+	// Server# gate: debug (inherited)
+	// Server# gate: error
+	// Server# gate: error
+	// Server# unknown logger or level: nosuch
+	// Server# gate: debug (inherited)
+	// Server#
+}
@@ -0,0 +1,184 @@
+package mysql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/zfiona/server-base/db/mysql"
+	"strings"
+	"sync"
+)
+
+// fakeDriver a server per address of the DSN, no live server needed
+type fakeDriver struct{}
+
+type fakeConn struct {
+	addr string
+}
+
+var (
+	fakeMutex sync.Mutex
+	fakeDown  = make(map[string]bool)
+	fakeExecs []string
+)
+
+func init() {
+	sql.Register("fakemysql", fakeDriver{})
+	mysql.SetDriver("fakemysql")
+}
+
+func setDown(addr string, down bool) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+
+	fakeDown[addr] = down
+}
+
+func check(addr string) error {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+
+	if fakeDown[addr] {
+		return errors.New("down")
+	}
+	return nil
+}
+
+// execs the addresses of the servers executing the statements since the last
+// call
+func execs() []string {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+
+	addrs := fakeExecs
+	fakeExecs = nil
+	return addrs
+}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	// user:password@tcp(addr)/name?...
+	addr := dsn[strings.Index(dsn, "(")+1 : strings.Index(dsn, ")")]
+	err := check(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeConn{addr: addr}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return check(c.addr)
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+
+	fakeExecs = append(fakeExecs, c.addr)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func ExampleOpen() {
+	c := &mysql.Config{
+		Account:      "root",
+		Addr:         "10.0.0.1:3306",
+		DbName:       "game",
+		PingInterval: -1,
+	}
+	fmt.Println(mysql.Open("game", c))
+	fmt.Println(mysql.Open("game", c))
+	fmt.Println(mysql.Get("game") != nil, mysql.Get("log") == nil)
+
+	// the primary server must answer
+	setDown("10.0.0.9:3306", true)
+	bad := *c
+	bad.Addr = "10.0.0.9:3306"
+	fmt.Println(mysql.OpenDB(&bad))
+	fmt.Println(mysql.DB() == nil, mysql.SqlDb() == nil, mysql.Names())
+
+	fmt.Println(mysql.OpenDB(c))
+	fmt.Println(mysql.DB() == mysql.Get(mysql.DefaultName).Write(), mysql.Names())
+
+	fmt.Println(mysql.Close("game"), mysql.Close("game"))
+	fmt.Println(mysql.CloseAll(), mysql.Names())
+
+	// Output:
+	// <nil>
+	// mysql game: already open
+	// true true
+	// mysql main: connect 10.0.0.9:3306: down
+	// true true [game]
+	// <nil>
+	// true [game main]
+	// <nil> mysql game: not open
+	// <nil> []
+}
+
+func ExampleDatabase_Read() {
+	c := &mysql.Config{
+		Account:      "root",
+		Addr:         "10.0.0.1:3306",
+		DbName:       "game",
+		Replicas:     []string{"10.0.0.2:3306", "10.0.0.3:3306"},
+		PingInterval: -1,
+	}
+
+	// a replica which does not answer is used once it answers a ping
+	setDown("10.0.0.3:3306", true)
+	err := mysql.Open("replicas", c)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer mysql.Close("replicas")
+	db := mysql.Get("replicas")
+
+	read := func() {
+		for i := 0; i < 4; i++ {
+			db.Read().DB().Exec("SELECT 1")
+		}
+		db.Write().DB().Exec("SELECT 1")
+		fmt.Println(execs())
+	}
+	read()
+
+	setDown("10.0.0.3:3306", false)
+	fmt.Println(db.Ping())
+	read()
+
+	// the primary server if no replica answers
+	setDown("10.0.0.2:3306", true)
+	setDown("10.0.0.3:3306", true)
+	fmt.Println(db.Ping())
+	read()
+	fmt.Println(db.Healthy())
+
+	setDown("10.0.0.1:3306", true)
+	fmt.Println(db.Ping() != nil, db.Healthy())
+	setDown("10.0.0.1:3306", false)
+	setDown("10.0.0.2:3306", false)
+	setDown("10.0.0.3:3306", false)
+
+	// Output:
+	// [10.0.0.2:3306 10.0.0.2:3306 10.0.0.2:3306 10.0.0.2:3306 10.0.0.1:3306]
+	// <nil>
+	// [10.0.0.3:3306 10.0.0.2:3306 10.0.0.3:3306 10.0.0.2:3306 10.0.0.1:3306]
+	// mysql replicas: replica 10.0.0.2:3306: down
+	// mysql replicas: replica 10.0.0.3:3306: down
+	// [10.0.0.1:3306 10.0.0.1:3306 10.0.0.1:3306 10.0.0.1:3306 10.0.0.1:3306]
+	// true
+	// true false
+}
@@ -0,0 +1,7 @@
+package mysql
+
+// SetDriver replaces the driver of the servers, an example registering a
+// driver by sql.Register starts with it
+func SetDriver(name string) {
+	driverName = name
+}
@@ -7,34 +7,300 @@ import (
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 	"github.com/zfiona/server-base/log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultName the database of OpenDB and DB
+const DefaultName = "main"
+
 var (
-	db *gorm.DB
+	mutex sync.Mutex
+	dbs   = make(map[string]*Database)
+
+	// the driver of the servers, replaced by the tests
+	driverName = "mysql"
 )
 
 type Config struct {
-	Account string   //"root"
-	Password string  //"123456"
-	Addr string      //"127.0.0.1:3306"
-	DbName string	 //"game"
+	Account  string //"root"
+	Password string //"123456"
+	Addr     string //"127.0.0.1:3306"
+	DbName   string //"game"
+
+	// the pool of each server, 0 means no limit
+	MaxOpen         int
+	MaxIdle         int // 0 means the default of database/sql, 2
+	ConnMaxLifetime time.Duration
+
+	// read-only replicas of the database, same account and name
+	Replicas []string
+
+	// how often the servers are pinged, 30 seconds if 0, never if negative
+	PingInterval time.Duration
+}
+
+// Database a database, its primary server and its replicas
+type Database struct {
+	name     string
+	primary  *conn
+	replicas []*conn
+	next     uint32
+	closeSig chan struct{}
+	wg       sync.WaitGroup
+}
+
+type conn struct {
+	addr    string
+	db      *gorm.DB
+	healthy int32
+}
+
+func (c *conn) isHealthy() bool {
+	return atomic.LoadInt32(&c.healthy) == 1
+}
+
+// ping updates the health of the server, the changes are logged
+func (c *conn) ping(name string) error {
+	err := c.db.DB().Ping()
+	healthy := int32(1)
+	if err != nil {
+		healthy = 0
+	}
+	if atomic.SwapInt32(&c.healthy, healthy) != healthy {
+		if err != nil {
+			log.Error("mysql %v: %v down: %v", name, c.addr, err)
+		} else {
+			log.Release("mysql %v: %v up", name, c.addr)
+		}
+	}
+	return err
+}
+
+// dial connects to the server, the conn is returned with the error of the
+// first ping, unhealthy, unless the connection itself failed
+func dial(c *Config, addr string) (*conn, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8&parseTime=true&loc=Local", c.Account, c.Password, addr, c.DbName)
+	sqlDB, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(c.MaxOpen)
+	if c.MaxIdle != 0 {
+		sqlDB.SetMaxIdleConns(c.MaxIdle)
+	}
+	sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+
+	// pings the server
+	db, err := gorm.Open("mysql", sqlDB)
+	if db == nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	cn := &conn{addr: addr, db: db}
+	if err == nil {
+		cn.healthy = 1
+	}
+	return cn, err
+}
+
+// Open goroutine safe
+// connects to the database and registers it under name. The primary server
+// must answer, a replica which does not is used once it answers a ping
+func Open(name string, c *Config) error {
+	log.Release("mysql %v: open %v/%v", name, c.Addr, c.DbName)
+
+	mutex.Lock()
+	_, ok := dbs[name]
+	mutex.Unlock()
+	if ok {
+		return fmt.Errorf("mysql %v: already open", name)
+	}
+
+	primary, err := dial(c, c.Addr)
+	if err != nil {
+		if primary != nil {
+			primary.db.Close()
+		}
+		return fmt.Errorf("mysql %v: connect %v: %w", name, c.Addr, err)
+	}
+
+	db := &Database{name: name, primary: primary}
+	for _, addr := range c.Replicas {
+		replica, err := dial(c, addr)
+		if replica == nil {
+			db.close()
+			return fmt.Errorf("mysql %v: replica %v: %w", name, addr, err)
+		}
+		if err != nil {
+			log.Error("mysql %v: replica %v down: %v", name, addr, err)
+		}
+		db.replicas = append(db.replicas, replica)
+	}
+
+	mutex.Lock()
+	if _, ok := dbs[name]; ok {
+		mutex.Unlock()
+		db.close()
+		return fmt.Errorf("mysql %v: already open", name)
+	}
+	dbs[name] = db
+	mutex.Unlock()
+
+	interval := c.PingInterval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	if interval > 0 {
+		db.closeSig = make(chan struct{})
+		db.wg.Add(1)
+		go db.healthCheck(interval)
+	}
+	return nil
+}
+
+func (db *Database) healthCheck(interval time.Duration) {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			db.Ping()
+		case <-db.closeSig:
+			return
+		}
+	}
 }
 
-func OpenDB(c *Config) {
-	log.Debug("redis->open db")
-	var err error
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8&parseTime=true&loc=Local", c.Account, c.Password, c.Addr, c.DbName)
-	db, err = gorm.Open("mysql", dsn)
+// Get goroutine safe
+// the database registered under name, nil if none
+func Get(name string) *Database {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return dbs[name]
+}
+
+// Names goroutine safe
+func Names() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	names := make([]string, 0, len(dbs))
+	for name := range dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write goroutine safe
+// the primary server, for writes and consistent reads
+func (db *Database) Write() *gorm.DB {
+	return db.primary.db
+}
+
+// Read goroutine safe
+// a healthy replica in turn, the primary server if none
+func (db *Database) Read() *gorm.DB {
+	n := len(db.replicas)
+	if n == 0 {
+		return db.primary.db
+	}
+	start := atomic.AddUint32(&db.next, 1)
+	for i := 0; i < n; i++ {
+		replica := db.replicas[(int(start)+i)%n]
+		if replica.isHealthy() {
+			return replica.db
+		}
+	}
+	return db.primary.db
+}
+
+// Healthy goroutine safe
+// whether the primary server answered the last ping
+func (db *Database) Healthy() bool {
+	return db.primary.isHealthy()
+}
+
+// Ping goroutine safe
+// pings the servers now, the health of the replicas follows
+func (db *Database) Ping() error {
+	var errs []error
+	err := db.primary.ping(db.name)
 	if err != nil {
-		panic("connect db error")
+		errs = append(errs, fmt.Errorf("mysql %v: %v: %w", db.name, db.primary.addr, err))
+	}
+	for _, replica := range db.replicas {
+		err := replica.ping(db.name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mysql %v: replica %v: %w", db.name, replica.addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (db *Database) close() error {
+	if db.closeSig != nil {
+		close(db.closeSig)
+		db.wg.Wait()
+	}
+
+	var errs []error
+	errs = append(errs, db.primary.db.Close())
+	for _, replica := range db.replicas {
+		errs = append(errs, replica.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Close goroutine safe
+// closes the database registered under name
+func Close(name string) error {
+	mutex.Lock()
+	db, ok := dbs[name]
+	delete(dbs, name)
+	mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("mysql %v: not open", name)
+	}
+	return db.close()
+}
+
+// CloseAll goroutine safe
+func CloseAll() error {
+	var errs []error
+	for _, name := range Names() {
+		errs = append(errs, Close(name))
 	}
+	return errors.Join(errs...)
 }
 
+// OpenDB goroutine safe
+// opens the database DefaultName
+func OpenDB(c *Config) error {
+	return Open(DefaultName, c)
+}
+
+// DB the primary server of the database DefaultName
 func DB() *gorm.DB {
-	return db
+	db := Get(DefaultName)
+	if db == nil {
+		return nil
+	}
+	return db.Write()
 }
 
 func SqlDb() *sql.DB {
+	db := DB()
+	if db == nil {
+		return nil
+	}
 	return db.DB()
 }
 
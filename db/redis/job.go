@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+)
+
+// JobStore a job.Store and job.Locker shared by the servers of a cluster
+// OpenDB must be called first
+type JobStore struct {
+	Prefix string // default "job:"
+}
+
+func (s *JobStore) key(name string) string {
+	if s.Prefix == "" {
+		return "job:" + name
+	}
+	return s.Prefix + name
+}
+
+func (s *JobStore) LastRun(name string) (time.Time, error) {
+	v, err := rdb.Get(s.key(name)).Result()
+	if IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nsec), nil
+}
+
+func (s *JobStore) SetLastRun(name string, t time.Time) error {
+	return rdb.Set(s.key(name), t.UnixNano(), 0).Err()
+}
+
+func (s *JobStore) Lock(key string, ttl time.Duration) (bool, error) {
+	return rdb.SetNX(s.key("lock:"+key), 1, ttl).Result()
+}
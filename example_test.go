@@ -0,0 +1,63 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/zfiona/server-base"
+	"github.com/zfiona/server-base/module"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type exampleModule struct {
+	name    string
+	deps    []string
+	running chan struct{}
+}
+
+func (m *exampleModule) Name() string        { return m.name }
+func (m *exampleModule) DependsOn() []string { return m.deps }
+func (m *exampleModule) OnInit()             {}
+func (m *exampleModule) OnPreStop()          { fmt.Println("prestop", m.name) }
+func (m *exampleModule) OnDestroy()          { fmt.Println("destroy", m.name) }
+func (m *exampleModule) Run(closeSig chan bool) {
+	close(m.running)
+	<-closeSig
+}
+
+func Example() {
+	// the process is not killed by a SIGTERM sent before Run handles it
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	defer signal.Stop(c)
+
+	gate := &exampleModule{name: "gate", deps: []string{"game"}, running: make(chan struct{})}
+	game := &exampleModule{name: "game", running: make(chan struct{})}
+	go server.Run(gate, game)
+	<-gate.running
+	<-game.running
+
+	// SIGTERM until the server closes down, Run may not handle it yet
+	for {
+		state, _ := module.StateOf("gate")
+		if state != module.StateRunning {
+			break
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// waits until all the modules are destroyed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	fmt.Println(server.Shutdown(ctx))
+
+	// Output:
+	// prestop gate
+	// prestop game
+	// destroy gate
+	// destroy game
+	// <nil>
+}
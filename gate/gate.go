@@ -6,9 +6,15 @@ import (
 	"github.com/zfiona/server-base/network/tcp"
 	"github.com/zfiona/server-base/network/udp"
 	"github.com/zfiona/server-base/network/websocket"
+	"sync"
 	"time"
 )
 
+type acceptStopper interface {
+	StopAccept()
+	ConnNum() int32
+}
+
 type Gate struct {
 	MaxConnNum      int32
 	PendingWriteNum int32
@@ -25,6 +31,11 @@ type Gate struct {
 	TCPAddr  string
 	//udp
 	UDPAddr  string
+
+	// pre-stop: wait for connections to close, up to DrainTimeout
+	DrainTimeout time.Duration
+	mutexServers sync.Mutex
+	servers      []acceptStopper
 }
 
 func (gate *Gate) Run(closeSig chan bool) {
@@ -52,6 +63,7 @@ func (gate *Gate) RunWebServer(closeSig chan bool){
 	server.Processor = gate.Processor
 
 	server.Start()
+	gate.addServer(server)
 	<-closeSig
 	server.Close()
 }
@@ -67,6 +79,7 @@ func (gate *Gate) RunTcpServer(closeSig chan bool){
 	server.MsgParser = gate.MsgParser
 
 	server.Start()
+	gate.addServer(server)
 	<-closeSig
 	server.Close()
 }
@@ -85,6 +98,39 @@ func (gate *Gate) RunUdpServer(closeSig chan bool){
 	server.MsgParser = gate.MsgParser
 
 	server.Start()
+	gate.addServer(server)
 	<-closeSig
 	server.Close()
 }
+
+func (gate *Gate) addServer(server acceptStopper) {
+	gate.mutexServers.Lock()
+	gate.servers = append(gate.servers, server)
+	gate.mutexServers.Unlock()
+}
+
+// OnPreStop stops accepting new connections and drains the existing ones
+func (gate *Gate) OnPreStop() {
+	gate.mutexServers.Lock()
+	for _, server := range gate.servers {
+		server.StopAccept()
+	}
+	gate.mutexServers.Unlock()
+
+	deadline := time.Now().Add(gate.DrainTimeout)
+	for gate.connNum() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// connNum the connections of the servers of the gate
+func (gate *Gate) connNum() int32 {
+	gate.mutexServers.Lock()
+	defer gate.mutexServers.Unlock()
+
+	var n int32
+	for _, server := range gate.servers {
+		n += server.ConnNum()
+	}
+	return n
+}
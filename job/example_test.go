@@ -0,0 +1,171 @@
+package job_test
+
+import (
+	"fmt"
+	"github.com/zfiona/server-base/job"
+	"github.com/zfiona/server-base/timer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func ExampleScheduler() {
+	dir, err := ioutil.TempDir("", "job")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := job.NewFileStore(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		return
+	}
+	// the server was down for 3 days
+	store.SetLastRun("reward", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetLastRun("rank", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 4,
+		12, 0, 0,
+		0, time.UTC,
+	))
+	d := timer.NewDispatcherWithClock(10, clock)
+	s := job.NewScheduler(d, store)
+
+	daily, err := timer.NewCronExpr("@daily")
+	if err != nil {
+		return
+	}
+	s.Add(&job.Job{
+		Name:    "reward",
+		Expr:    daily,
+		CatchUp: job.CatchUpAll,
+		Func: func(scheduled time.Time) {
+			fmt.Println("reward", scheduled)
+		},
+	})
+	s.Add(&job.Job{
+		Name:    "rank",
+		Expr:    daily,
+		CatchUp: job.CatchUpOnce,
+		Func: func(scheduled time.Time) {
+			fmt.Println("rank", scheduled)
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Duration(i) * 24 * time.Hour)
+		for len(d.ChanTimer) > 0 {
+			(<-d.ChanTimer).Cb()
+		}
+	}
+	s.Stop()
+
+	// Output:
+	// reward 2000-01-02 00:00:00 +0000 UTC
+	// reward 2000-01-03 00:00:00 +0000 UTC
+	// reward 2000-01-04 00:00:00 +0000 UTC
+	// rank 2000-01-04 00:00:00 +0000 UTC
+	// reward 2000-01-05 00:00:00 +0000 UTC
+	// rank 2000-01-05 00:00:00 +0000 UTC
+}
+
+func ExampleCatchUpAll() {
+	dir, err := ioutil.TempDir("", "job")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := job.NewFileStore(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		return
+	}
+	// the server was down for 20 minutes
+	d := timer.NewDispatcher(10)
+	store.SetLastRun("tick", d.Now().Add(-20*time.Minute))
+	s := job.NewScheduler(d, store)
+
+	everyMinute, err := timer.NewCronExpr("* * * * *")
+	if err != nil {
+		return
+	}
+	var runs []time.Time
+	s.Add(&job.Job{
+		Name:    "tick",
+		Expr:    everyMinute,
+		CatchUp: job.CatchUpAll,
+		Func: func(scheduled time.Time) {
+			runs = append(runs, scheduled)
+		},
+	})
+
+	// the runtime timers fire the catch-up runs at once
+	(<-d.ChanTimer).Cb()
+	s.Stop()
+
+	fmt.Println(len(runs), "runs")
+	for i := 1; i < len(runs); i++ {
+		if runs[i].Sub(runs[i-1]) != time.Minute {
+			fmt.Println("out of order:", runs[i-1], runs[i])
+		}
+	}
+
+	// Output:
+	// 20 runs
+}
+
+func ExampleScheduler_MaxCatchUp() {
+	dir, err := ioutil.TempDir("", "job")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := job.NewFileStore(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		return
+	}
+	// the server was down for 30 days
+	store.SetLastRun("tick", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 31,
+		0, 0, 0,
+		0, time.UTC,
+	))
+	d := timer.NewDispatcherWithClock(10, clock)
+	s := job.NewScheduler(d, store)
+
+	everySecond, err := timer.NewCronExpr("* * * * * *")
+	if err != nil {
+		return
+	}
+	var runs []time.Time
+	start := time.Now()
+	s.Add(&job.Job{
+		Name:    "tick",
+		Expr:    everySecond,
+		CatchUp: job.CatchUpAll,
+		Func: func(scheduled time.Time) {
+			runs = append(runs, scheduled)
+		},
+	})
+	// the last runs only are looked for
+	fmt.Println(time.Since(start) < 100*time.Millisecond)
+
+	clock.Advance(0)
+	(<-d.ChanTimer).Cb()
+	s.Stop()
+
+	fmt.Println(len(runs), "runs")
+	fmt.Println(runs[0])
+	fmt.Println(runs[len(runs)-1])
+
+	// Output:
+	// true
+	// 100 runs
+	// 2000-01-30 23:58:21 +0000 UTC
+	// 2000-01-31 00:00:00 +0000 UTC
+}
@@ -0,0 +1,239 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zfiona/server-base/log"
+	"github.com/zfiona/server-base/timer"
+	"time"
+)
+
+// CatchUp what to do with the runs missed while the server was down
+type CatchUp int
+
+const (
+	// CatchUpOnce runs once for all the missed runs
+	CatchUpOnce CatchUp = iota
+	// CatchUpAll runs once for every missed run, up to Scheduler.MaxCatchUp
+	CatchUpAll
+	// CatchUpSkip ignores the missed runs
+	CatchUpSkip
+)
+
+// Store keeps the last run time of jobs
+type Store interface {
+	// LastRun the zero time if the job never ran
+	LastRun(name string) (time.Time, error)
+	SetLastRun(name string, t time.Time) error
+}
+
+// Locker makes sure one server of a cluster runs a job
+type Locker interface {
+	// Lock true if the lock is acquired, it is held until ttl expires
+	Lock(key string, ttl time.Duration) (bool, error)
+}
+
+// Timers a *module.Skeleton or a *timer.Dispatcher
+type Timers interface {
+	AfterFunc(d time.Duration, cb func()) *timer.Timer
+	Now() time.Time
+}
+
+type Job struct {
+	Name    string
+	Expr    *timer.CronExpr
+	CatchUp CatchUp
+	// Func is called on the goroutine of Timers with the scheduled time
+	Func func(scheduled time.Time)
+
+	t *timer.Timer
+}
+
+// Scheduler one scheduler per goroutine (goroutine not safe)
+// Store and Locker are called on the goroutine of Timers
+type Scheduler struct {
+	Store  Store
+	Locker Locker // optional
+	// how long a run is locked, default 1 minute
+	LockTTL time.Duration
+	// CatchUpAll only, default 100
+	MaxCatchUp int
+
+	timers Timers
+	jobs   map[string]*Job
+}
+
+func NewScheduler(timers Timers, store Store) *Scheduler {
+	s := new(Scheduler)
+	s.Store = store
+	s.LockTTL = time.Minute
+	s.MaxCatchUp = 100
+	s.timers = timers
+	s.jobs = make(map[string]*Job)
+	return s
+}
+
+// Add schedules the job and its catch-up runs
+func (s *Scheduler) Add(j *Job) error {
+	if j.Name == "" || j.Expr == nil || j.Func == nil {
+		return errors.New("invalid job")
+	}
+	if _, ok := s.jobs[j.Name]; ok {
+		return fmt.Errorf("job %v: already added", j.Name)
+	}
+
+	lastRun, err := s.Store.LastRun(j.Name)
+	if err != nil {
+		return fmt.Errorf("job %v: %v", j.Name, err)
+	}
+	s.jobs[j.Name] = j
+
+	now := s.timers.Now()
+	var missed []time.Time
+	switch j.CatchUp {
+	case CatchUpOnce:
+		if t := lastMissed(j.Expr, lastRun, now); !t.IsZero() {
+			missed = []time.Time{t}
+		}
+	case CatchUpAll:
+		missed = lastRuns(j.Expr, lastRun, now, s.MaxCatchUp)
+	default:
+		if t := firstMissed(j.Expr, lastRun, now); !t.IsZero() {
+			log.Release("job %v: runs missed since %v, skipped", j.Name, lastRun)
+		}
+	}
+	if len(missed) == 0 {
+		s.schedule(j, now)
+		return nil
+	}
+
+	// in order from a single callback, the runs of the job are then
+	// scheduled from now on
+	log.Release("job %v: catching up %v missed runs since %v", j.Name, len(missed), lastRun)
+	j.t = s.timers.AfterFunc(0, func() {
+		for _, scheduled := range missed {
+			s.run(j, scheduled)
+		}
+		if s.jobs[j.Name] == j {
+			s.schedule(j, now)
+		}
+	})
+	return nil
+}
+
+// Remove stops the job
+func (s *Scheduler) Remove(name string) {
+	j, ok := s.jobs[name]
+	if !ok {
+		return
+	}
+	if j.t != nil {
+		j.t.Stop()
+	}
+	delete(s.jobs, name)
+}
+
+// Stop stops all jobs
+func (s *Scheduler) Stop() {
+	for name := range s.jobs {
+		s.Remove(name)
+	}
+}
+
+// the first run in (lastRun, now], the zero time if none
+func firstMissed(expr *timer.CronExpr, lastRun time.Time, now time.Time) time.Time {
+	if lastRun.IsZero() {
+		return time.Time{}
+	}
+	t := expr.Next(lastRun)
+	if t.After(now) {
+		return time.Time{}
+	}
+	return t
+}
+
+// the last run in (lastRun, now], the zero time if none
+func lastMissed(expr *timer.CronExpr, lastRun time.Time, now time.Time) time.Time {
+	runs := lastRuns(expr, lastRun, now, 1)
+	if len(runs) == 0 {
+		return time.Time{}
+	}
+	return runs[0]
+}
+
+// the last n runs in (lastRun, now], oldest first. The runs are looked for
+// back from now in doubling windows rather than walked from lastRun, a long
+// time ago for a frequent job
+func lastRuns(expr *timer.CronExpr, lastRun time.Time, now time.Time, n int) []time.Time {
+	if lastRun.IsZero() || n <= 0 {
+		return nil
+	}
+
+	for window := time.Second; window > 0 && window < now.Sub(lastRun); window *= 2 {
+		if runs := runsIn(expr, now.Add(-window), now, n); len(runs) == n {
+			return runs
+		}
+	}
+	return runsIn(expr, lastRun, now, n)
+}
+
+// the last n runs in (from, to], oldest first
+func runsIn(expr *timer.CronExpr, from time.Time, to time.Time, n int) []time.Time {
+	var runs []time.Time
+	for t := expr.Next(from); !t.IsZero() && !t.After(to); t = expr.Next(t) {
+		runs = append(runs, t)
+		if len(runs) > n {
+			runs = runs[1:]
+		}
+	}
+	return runs
+}
+
+// schedule the first run after from
+func (s *Scheduler) schedule(j *Job, from time.Time) {
+	next := j.Expr.Next(from)
+	if next.IsZero() {
+		return
+	}
+
+	j.t = s.timers.AfterFunc(next.Sub(s.timers.Now()), func() {
+		if s.jobs[j.Name] != j {
+			return
+		}
+		s.run(j, next)
+		s.schedule(j, s.timers.Now())
+	})
+}
+
+func (s *Scheduler) run(j *Job, scheduled time.Time) {
+	if s.jobs[j.Name] != j {
+		return
+	}
+	if s.Locker != nil {
+		key := fmt.Sprintf("%v:%v", j.Name, scheduled.Unix())
+		ok, err := s.Locker.Lock(key, s.LockTTL)
+		if err != nil {
+			log.Error("job %v: lock error: %v", j.Name, err)
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+
+	lastRun, err := s.Store.LastRun(j.Name)
+	if err != nil {
+		log.Error("job %v: %v", j.Name, err)
+		return
+	}
+	if !lastRun.Before(scheduled) {
+		return
+	}
+
+	j.Func(scheduled)
+
+	err = s.Store.SetLastRun(j.Name, scheduled)
+	if err != nil {
+		log.Error("job %v: %v", j.Name, err)
+	}
+}
@@ -0,0 +1,73 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore a Store saved as a JSON file, for a single server
+type FileStore struct {
+	mutex    sync.Mutex
+	path     string
+	lastRuns map[string]time.Time
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := new(FileStore)
+	s.path = path
+	s.lastRuns = make(map[string]time.Time)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &s.lastRuns)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LastRun goroutine safe
+func (s *FileStore) LastRun(name string) (time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastRuns[name], nil
+}
+
+// SetLastRun goroutine safe
+// the file is replaced atomically
+func (s *FileStore) SetLastRun(name string, t time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastRuns[name] = t
+	data, err := json.MarshalIndent(s.lastRuns, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,152 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+)
+
+// policies when the buffer of an async logger is full
+const (
+	asyncBlock = iota
+	asyncDropDebug
+	asyncDropAll
+)
+
+func parsePolicy(policy string) (int, error) {
+	switch policy {
+	case "", "block":
+		return asyncBlock, nil
+	case "dropdebug":
+		return asyncDropDebug, nil
+	case "drop":
+		return asyncDropAll, nil
+	default:
+		return 0, errors.New("unknown log async policy: " + policy)
+	}
+}
+
+// asyncWriter entries are queued by the logging goroutines, with the output
+// mutex held, and encoded and written by a dedicated goroutine
+type asyncWriter struct {
+	policy  int
+	ch      chan asyncItem
+	done    chan struct{}
+	dropped uint64
+}
+
+type asyncItem struct {
+	level   int32
+	e       Entry
+	sinks   []*sink
+	encoder Encoder
+	flushed chan struct{}
+}
+
+func newAsyncWriter(size int, policy int) *asyncWriter {
+	a := new(asyncWriter)
+	a.policy = policy
+	a.ch = make(chan asyncItem, size)
+	a.done = make(chan struct{})
+	go a.run()
+	return a
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.done)
+
+	var buf bytes.Buffer
+	for item := range a.ch {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		writeSinks(&buf, item.sinks, item.encoder, item.level, &item.e)
+	}
+}
+
+func (a *asyncWriter) write(level int32, e *Entry, sinks []*sink, encoder Encoder) {
+	item := asyncItem{level: level, e: *e, sinks: sinks, encoder: encoder}
+	if a.policy == asyncBlock || a.policy == asyncDropDebug && level > debugLevel {
+		a.ch <- item
+		return
+	}
+
+	select {
+	case a.ch <- item:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// flush returns a channel closed once the entries queued so far are written
+func (a *asyncWriter) flush() chan struct{} {
+	flushed := make(chan struct{})
+	a.ch <- asyncItem{flushed: flushed}
+	return flushed
+}
+
+// close writes the queued entries
+func (a *asyncWriter) close() {
+	close(a.ch)
+	<-a.done
+}
+
+// SetAsync It's dangerous to call the method on logging
+// entries are written by a dedicated goroutine through a buffer of size
+// entries. When the buffer is full, policy "block" waits, "dropdebug" drops
+// debug entries and waits for the others, "drop" drops any entry
+func (logger *Logger) SetAsync(size int, policy string) error {
+	p, err := parsePolicy(policy)
+	if err != nil {
+		return err
+	}
+	if size <= 0 {
+		return errors.New("invalid log async size")
+	}
+
+	out, _ := logger.getOutput()
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if out.closed {
+		panic("logger closed")
+	}
+	if out.async != nil {
+		return errors.New("logger already async")
+	}
+	out.async = newAsyncWriter(size, p)
+	return nil
+}
+
+// Flush goroutine safe
+// waits for the queued entries of an async logger to be written
+func (logger *Logger) Flush() {
+	out, _ := logger.getOutput()
+	out.mutex.Lock()
+	if out.async == nil {
+		out.mutex.Unlock()
+		return
+	}
+	flushed := out.async.flush()
+	out.mutex.Unlock()
+
+	<-flushed
+}
+
+// Dropped goroutine safe
+// the number of entries dropped by an async logger
+func (logger *Logger) Dropped() uint64 {
+	out, _ := logger.getOutput()
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if out.async == nil {
+		return out.dropped
+	}
+	return out.dropped + atomic.LoadUint64(&out.async.dropped)
+}
+
+func Flush() {
+	gLogger.Flush()
+}
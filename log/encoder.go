@@ -0,0 +1,236 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Entry a log entry, File is empty unless Flag asks for it
+type Entry struct {
+	Time   time.Time
+	Level  string
+	File   string
+	Line   int
+	Msg    string
+	Fields []Field
+	Flag   int // flags of the standard log package
+}
+
+// Encoder writes an entry as one line
+type Encoder interface {
+	Encode(buf *bytes.Buffer, e *Entry)
+}
+
+type EncoderFunc func(buf *bytes.Buffer, e *Entry)
+
+func (f EncoderFunc) Encode(buf *bytes.Buffer, e *Entry) {
+	f(buf, e)
+}
+
+var (
+	// TextEncoder the classic format: 15:04:05 file.go:12: [release] msg key=value
+	TextEncoder Encoder = EncoderFunc(encodeText)
+	// JSONEncoder one JSON object per line
+	JSONEncoder Encoder = EncoderFunc(encodeJSON)
+	// LogfmtEncoder time=... level=release msg=... key=value
+	LogfmtEncoder Encoder = EncoderFunc(encodeLogfmt)
+)
+
+// NewEncoder "text", "json" or "logfmt"
+func NewEncoder(format string) (Encoder, error) {
+	switch format {
+	case "", "text":
+		return TextEncoder, nil
+	case "json":
+		return JSONEncoder, nil
+	case "logfmt":
+		return LogfmtEncoder, nil
+	default:
+		return nil, errors.New("unknown log format: " + format)
+	}
+}
+
+func (e *Entry) caller() string {
+	if e.File == "" {
+		return ""
+	}
+	file := e.File
+	if e.Flag&log.Lshortfile != 0 {
+		file = filepath.Base(file)
+	}
+	return file + ":" + strconv.Itoa(e.Line)
+}
+
+func (e *Entry) time() string {
+	t := e.Time
+	if e.Flag&log.LUTC != 0 {
+		t = t.UTC()
+	}
+	if e.Flag&log.Lmicroseconds != 0 {
+		return t.Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+const timeFlags = log.Ldate | log.Ltime | log.Lmicroseconds
+
+func (e *Entry) hasTime() bool {
+	return e.Flag&timeFlags != 0
+}
+
+// the header of the standard log package
+func encodeHeader(buf *bytes.Buffer, e *Entry) {
+	t := e.Time
+	if e.Flag&log.LUTC != 0 {
+		t = t.UTC()
+	}
+	if e.Flag&log.Ldate != 0 {
+		buf.WriteString(t.Format("2006/01/02 "))
+	}
+	if e.Flag&(log.Ltime|log.Lmicroseconds) != 0 {
+		if e.Flag&log.Lmicroseconds != 0 {
+			buf.WriteString(t.Format("15:04:05.000000 "))
+		} else {
+			buf.WriteString(t.Format("15:04:05 "))
+		}
+	}
+	if c := e.caller(); c != "" {
+		buf.WriteString(c)
+		buf.WriteString(": ")
+	}
+}
+
+func encodeText(buf *bytes.Buffer, e *Entry) {
+	encodeHeader(buf, e)
+	buf.WriteByte('[')
+	buf.WriteString(e.Level)
+	buf.WriteString("] ")
+	buf.WriteString(e.Msg)
+	for _, f := range e.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		writeLogfmtValue(buf, f.Value)
+	}
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
+
+func encodeJSON(buf *bytes.Buffer, e *Entry) {
+	buf.WriteByte('{')
+	if e.hasTime() {
+		writeJSONString(buf, "time")
+		buf.WriteByte(':')
+		writeJSONString(buf, e.time())
+		buf.WriteByte(',')
+	}
+	writeJSONString(buf, "level")
+	buf.WriteByte(':')
+	writeJSONString(buf, e.Level)
+	if c := e.caller(); c != "" {
+		buf.WriteByte(',')
+		writeJSONString(buf, "caller")
+		buf.WriteByte(':')
+		writeJSONString(buf, c)
+	}
+	buf.WriteByte(',')
+	writeJSONString(buf, "msg")
+	buf.WriteByte(':')
+	writeJSONString(buf, e.Msg)
+	for _, f := range e.Fields {
+		buf.WriteByte(',')
+		writeJSONString(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, f.Value)
+	}
+	buf.WriteString("}\n")
+}
+
+func encodeLogfmt(buf *bytes.Buffer, e *Entry) {
+	if e.hasTime() {
+		buf.WriteString("time=")
+		buf.WriteString(e.time())
+		buf.WriteByte(' ')
+	}
+	buf.WriteString("level=")
+	buf.WriteString(e.Level)
+	if c := e.caller(); c != "" {
+		buf.WriteString(" caller=")
+		writeLogfmtValue(buf, c)
+	}
+	buf.WriteString(" msg=")
+	writeLogfmtValue(buf, e.Msg)
+	for _, f := range e.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		writeLogfmtValue(buf, f.Value)
+	}
+	buf.WriteByte('\n')
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case error:
+		writeJSONString(buf, v.Error())
+		return
+	case time.Duration:
+		writeJSONString(buf, v.String())
+		return
+	case json.Marshaler:
+	case fmt.Stringer:
+		writeJSONString(buf, v.String())
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeJSONString(buf, fmt.Sprint(v))
+		return
+	}
+	buf.Write(data)
+}
+
+func writeLogfmtValue(buf *bytes.Buffer, v interface{}) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if needsQuote(s) {
+		buf.WriteString(strconv.Quote(s))
+	} else {
+		buf.WriteString(s)
+	}
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
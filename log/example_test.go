@@ -1,8 +1,19 @@
 package log_test
 
 import (
+	"compress/gzip"
+	"fmt"
 	l "log"
 	"github.com/zfiona/server-base/log"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 )
 
 func Example() {
@@ -27,3 +38,242 @@ func Example() {
 	log.Debug("will not print")
 	log.Release("My name is %v", name)
 }
+
+func ExampleLogger_With() {
+	logger, err := log.New("debug", "", 0)
+	if err != nil {
+		return
+	}
+	defer logger.Close()
+
+	agent := logger.With("module", "game", "agent", 1001)
+	agent.Releasew("message received", "msgid", "C2S_Login", "size", 32)
+
+	logger.SetEncoder(log.JSONEncoder)
+	agent.Errorw("message dropped", "msgid", "C2S_Move", "reason", "rate limit")
+
+	logger.SetEncoder(log.LogfmtEncoder)
+	agent.Debug("pos %v,%v", 3, 4)
+
+	slog.New(log.NewHandler(logger)).WithGroup("req").Info("slog", "id", 7)
+
+	// Output:
+	// [release] message received module=game agent=1001 msgid=C2S_Login size=32
+	// {"level":"error","msg":"message dropped","module":"game","agent":1001,"msgid":"C2S_Move","reason":"rate limit"}
+	// level=debug msg="pos 3,4" module=game agent=1001
+	// level=release msg=slog req.id=7
+}
+
+func ExampleLogger_SetAsync() {
+	logger, err := log.New("debug", "", 0)
+	if err != nil {
+		return
+	}
+	// written by a dedicated goroutine, debug entries are dropped when
+	// 1024 entries are waiting
+	err = logger.SetAsync(1024, "dropdebug")
+	if err != nil {
+		return
+	}
+
+	logger.Release("My name is %v", "Leaf")
+	logger.Flush()
+	fmt.Println("flushed")
+
+	logger.Error("written on Close")
+	logger.Close()
+
+	// Output:
+	// [release] My name is Leaf
+	// flushed
+	// [error] written on Close
+}
+
+func ExampleNamed() {
+	logger, err := log.New("release", "", 0)
+	if err != nil {
+		return
+	}
+	defer logger.Close()
+	log.Export(logger)
+
+	gate := log.Named("gate")
+	game := log.Named("game")
+
+	// debugging the game module only
+	log.SetNamedLevel("game", "debug")
+
+	gate.Debug("will not print")
+	game.Debug("room %v created", 12)
+
+	level, inherited, _ := log.NamedLevel("gate")
+	fmt.Println(level, inherited)
+
+	// Output:
+	// [debug] room 12 created logger=game
+	// release true
+}
+
+func ExampleNewWithSinks() {
+	// a local collector
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return
+	}
+	defer pc.Close()
+
+	w, err := log.DialNet("udp", pc.LocalAddr().String())
+	if err != nil {
+		return
+	}
+	logger, err := log.NewWithSinks("debug", 0,
+		log.Sink{Writer: os.Stdout},
+		log.Sink{Writer: w, Level: "error", Encoder: log.JSONEncoder},
+	)
+	if err != nil {
+		return
+	}
+	defer logger.Close()
+
+	logger.Debug("stdout only")
+	logger.Errorw("both", "agent", 1001)
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		return
+	}
+	fmt.Print(string(buf[:n]))
+
+	// Output:
+	// [debug] stdout only
+	// [error] both agent=1001
+	// {"level":"error","msg":"both","agent":1001}
+}
+
+var timeRegexp = regexp.MustCompile(`\d{8}_\d{2}_\d{2}_\d{2}(_\d+)?`)
+
+// printFiles the files of dir in order of name with their content, the
+// time stamps hidden
+func printFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, e := range entries {
+		var r io.Reader
+		file, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		r = file
+		if strings.HasSuffix(e.Name(), ".gz") {
+			r, err = gzip.NewReader(file)
+			if err != nil {
+				fmt.Println(err)
+				file.Close()
+				return
+			}
+		}
+		data, _ := io.ReadAll(r)
+		file.Close()
+		fmt.Printf("%v: %q\n", timeRegexp.ReplaceAllString(e.Name(), "T"), data)
+	}
+}
+
+func ExampleOpenFile() {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := log.OpenFile(dir, log.FileOptions{Name: "game", MaxSize: 10})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for i := 1; i <= 3; i++ {
+		fmt.Fprintf(f, "line %v\n", i)
+	}
+	f.Close()
+	printFiles(dir)
+
+	// Output:
+	// game_T.log: "line 1\n"
+	// game_T.log: "line 2\n"
+	// game_T.log: "line 3\n"
+}
+
+func ExampleFileOptions() {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// the files of a previous run, of another process and of an older version
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"game_19990101_00_00_00.log", "gate_19990101_00_00_00.log", "19990101_00_00_00.log"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("old\n"), 0644)
+		os.Chtimes(filepath.Join(dir, name), old, old)
+	}
+
+	// the old file of game is removed
+	f, err := log.OpenFile(dir, log.FileOptions{Name: "game", MaxAge: 24 * time.Hour})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Fprintln(f, "a")
+	f.Close()
+
+	// 2 rotated files of game are kept
+	f, err = log.OpenFile(dir, log.FileOptions{Name: "game", MaxBackups: 2})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, line := range []string{"b", "c", "d"} {
+		fmt.Fprintln(f, line)
+		if line != "d" {
+			f.Rotate()
+		}
+	}
+	f.Close()
+	printFiles(dir)
+
+	// Output:
+	// T.log: "old\n"
+	// game_T.log: "b\n"
+	// game_T.log: "c\n"
+	// game_T.log: "d\n"
+	// gate_T.log: "old\n"
+}
+
+func ExampleFile_Rotate() {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// rotated files are gzipped
+	f, err := log.OpenFile(dir, log.FileOptions{Name: "game", Compress: true})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Fprintln(f, "a")
+	f.Rotate()
+	fmt.Fprintln(f, "b")
+	f.Close()
+	printFiles(dir)
+
+	// Output:
+	// game_T.log.gz: "a\n"
+	// game_T.log: "b\n"
+}
@@ -0,0 +1,313 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOptions the zero value never rotates and keeps every file
+type FileOptions struct {
+	// the files are named Name_20060102_15_04_05.log, only the files of this
+	// name are compressed and removed: processes sharing a directory need
+	// different names. The program name by default
+	Name string
+	// rotate when a file would exceed MaxSize bytes, 0 means no limit
+	MaxSize int64
+	// rotate every hour or day on the clock: "hourly", "daily" or ""
+	Interval string
+	// gzip rotated files
+	Compress bool
+	// how many rotated files to keep, 0 means all
+	MaxBackups int
+	// how long to keep rotated files, 0 means forever
+	MaxAge time.Duration
+}
+
+// File a log file in a directory, named after its creation time and
+// rotated as configured
+type File struct {
+	mutex      sync.Mutex
+	dir        string
+	opts       FileOptions
+	nameRegexp *regexp.Regexp
+	file       *os.File
+	name       string
+	size       int64
+	nextRotate time.Time
+
+	millCh   chan struct{}
+	millDone chan struct{}
+}
+
+func OpenFile(dir string, opts FileOptions) (*File, error) {
+	switch opts.Interval {
+	case "", "hourly", "daily":
+	default:
+		return nil, errors.New("unknown log rotation interval: " + opts.Interval)
+	}
+
+	if opts.Name == "" {
+		opts.Name = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	}
+
+	f := new(File)
+	f.dir = dir
+	f.opts = opts
+	f.nameRegexp = regexp.MustCompile(`^` + regexp.QuoteMeta(opts.Name) + `_(\d{8}_\d{2}_\d{2}_\d{2})(?:_(\d+))?\.log(?:\.gz)?$`)
+	err := f.open(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	f.millCh = make(chan struct{}, 1)
+	f.millDone = make(chan struct{})
+	go f.mill()
+	f.millCh <- struct{}{}
+	return f, nil
+}
+
+// open with f.mutex held
+func (f *File) open(now time.Time) error {
+	name := fmt.Sprintf("%v_%d%02d%02d_%02d_%02d_%02d",
+		f.opts.Name,
+		now.Year(),
+		now.Month(),
+		now.Day(),
+		now.Hour(),
+		now.Minute(),
+		now.Second())
+
+	var file *os.File
+	var err error
+	for i := 0; ; i++ {
+		filename := name + ".log"
+		if i > 0 {
+			filename = fmt.Sprintf("%v_%v.log", name, i)
+		}
+		file, err = os.OpenFile(filepath.Join(f.dir, filename), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	f.name = filepath.Base(file.Name())
+	f.size = 0
+	switch f.opts.Interval {
+	case "hourly":
+		f.nextRotate = time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
+	case "daily":
+		f.nextRotate = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	}
+	return nil
+}
+
+// Write goroutine safe
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := time.Now()
+	if f.size > 0 && (f.opts.MaxSize > 0 && f.size+int64(len(p)) > f.opts.MaxSize ||
+		!f.nextRotate.IsZero() && !now.Before(f.nextRotate)) {
+		err := f.rotate(now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate goroutine safe
+// the current file is closed and a new one is created
+func (f *File) Rotate() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate(time.Now())
+}
+
+// Size goroutine safe
+// the size of the current file
+func (f *File) Size() int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.size
+}
+
+// rotate with f.mutex held, on failure the current file is kept
+func (f *File) rotate(now time.Time) error {
+	old := f.file
+	oldName := f.name
+	oldSize := f.size
+	err := f.open(now)
+	if err != nil {
+		f.file = old
+		f.name = oldName
+		f.size = oldSize
+		return err
+	}
+	old.Close()
+
+	select {
+	case f.millCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close goroutine safe
+// waits for the compression of rotated files
+func (f *File) Close() error {
+	f.mutex.Lock()
+	if f.file == nil {
+		f.mutex.Unlock()
+		return os.ErrClosed
+	}
+	err := f.file.Close()
+	f.file = nil
+	f.mutex.Unlock()
+
+	close(f.millCh)
+	<-f.millDone
+	return err
+}
+
+// current the name of the current file, kept after Close
+func (f *File) current() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.name
+}
+
+// mill compresses rotated files and applies retention, one run at a time
+func (f *File) mill() {
+	defer close(f.millDone)
+	for range f.millCh {
+		err := f.millRun()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log: %v\n", err)
+		}
+	}
+}
+
+func (f *File) millRun() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+
+	// rotated files of f, oldest first
+	current := f.current()
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == current || !f.nameRegexp.MatchString(name) {
+			continue
+		}
+		if f.opts.Compress && !strings.HasSuffix(name, ".gz") {
+			// a file gzipped before a crash and not removed
+			if _, err := os.Stat(filepath.Join(f.dir, name+".gz")); err == nil {
+				os.Remove(filepath.Join(f.dir, name))
+				continue
+			}
+			err := compressFile(filepath.Join(f.dir, name))
+			if err != nil {
+				return err
+			}
+			name += ".gz"
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		mi := f.nameRegexp.FindStringSubmatch(names[i])
+		mj := f.nameRegexp.FindStringSubmatch(names[j])
+		if mi[1] != mj[1] {
+			return mi[1] < mj[1]
+		}
+		ni, _ := strconv.Atoi(mi[2])
+		nj, _ := strconv.Atoi(mj[2])
+		return ni < nj
+	})
+
+	var remove []string
+	if f.opts.MaxBackups > 0 && len(names) > f.opts.MaxBackups {
+		remove = names[:len(names)-f.opts.MaxBackups]
+		names = names[len(names)-f.opts.MaxBackups:]
+	}
+	if f.opts.MaxAge > 0 {
+		cutoff := time.Now().Add(-f.opts.MaxAge)
+		for _, name := range names {
+			info, err := os.Stat(filepath.Join(f.dir, name))
+			if err == nil && info.ModTime().Before(cutoff) {
+				remove = append(remove, name)
+			}
+		}
+	}
+	for _, name := range remove {
+		err := os.Remove(filepath.Join(f.dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressFile gzips name into name.gz and removes name
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+".gz.tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(name+".gz.tmp", name+".gz")
+	}
+	if err != nil {
+		os.Remove(name + ".gz.tmp")
+		return err
+	}
+	os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
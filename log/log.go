@@ -1,13 +1,17 @@
 package log
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/zfiona/server-base/conf"
+	"io"
 	"log"
 	"os"
-	"path"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,108 +23,370 @@ const (
 	fatalLevel   = 3
 )
 
-const (
-	printDebugLevel   = "[debug] "
-	printReleaseLevel = "[release] "
-	printErrorLevel   = "[error] "
-	printFatalLevel   = "[fatal] "
-)
+// Field a key-value pair of a structured log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
 
 type Logger struct {
-	level      int
-	baseLogger *log.Logger
-	baseFile   *os.File
+	level  *int32
+	flag   int
+	fields []Field
+	out    *output
+	// a named logger writes through the exported logger, with its own
+	// level or the level of the exported logger if negative
+	name string
 }
 
-func New(strLevel string, pathname string, flag int) (*Logger, error) {
-	// level
-	var level int
+// output shared by a logger and its children
+type output struct {
+	mutex   sync.Mutex
+	encoder Encoder
+	sinks   []*sink // copied on write
+	closed  bool
+	buf     bytes.Buffer
+	async   *asyncWriter
+	dropped uint64
+}
+
+// Sink a destination of the entries of a logger
+type Sink struct {
+	Writer io.Writer
+	// the lowest level written to the sink, all levels of the logger if empty
+	Level string
+	// the encoder of the logger if nil
+	Encoder Encoder
+}
+
+type sink struct {
+	Sink
+	level int32
+}
+
+func newSink(s Sink) (*sink, error) {
+	if s.Writer == nil {
+		return nil, errors.New("invalid sink writer")
+	}
+	var level int32
+	if s.Level != "" {
+		var err error
+		level, err = parseLevel(s.Level)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &sink{s, level}, nil
+}
+
+// writeSinks each entry is written with one call to Write
+func writeSinks(buf *bytes.Buffer, sinks []*sink, encoder Encoder, level int32, e *Entry) {
+	for _, s := range sinks {
+		if level < s.level {
+			continue
+		}
+		enc := s.Encoder
+		if enc == nil {
+			enc = encoder
+		}
+		buf.Reset()
+		enc.Encode(buf, e)
+		s.Writer.Write(buf.Bytes())
+	}
+}
+
+func parseLevel(strLevel string) (int32, error) {
 	switch strings.ToLower(strLevel) {
 	case "debug":
-		level = debugLevel
+		return debugLevel, nil
 	case "release":
-		level = releaseLevel
+		return releaseLevel, nil
 	case "error":
-		level = errorLevel
+		return errorLevel, nil
 	case "fatal":
-		level = fatalLevel
+		return fatalLevel, nil
+	default:
+		return 0, errors.New("unknown level: " + strLevel)
+	}
+}
+
+func levelName(level int32) string {
+	switch level {
+	case debugLevel:
+		return "debug"
+	case releaseLevel:
+		return "release"
+	case errorLevel:
+		return "error"
 	default:
-		return nil, errors.New("unknown level: " + strLevel)
-	}
-
-	// logger
-	var baseLogger *log.Logger
-	var baseFile *os.File
-	if pathname != "" {
-		now := time.Now()
-
-		filename := fmt.Sprintf("%d%02d%02d_%02d_%02d_%02d.log",
-			now.Year(),
-			now.Month(),
-			now.Day(),
-			now.Hour(),
-			now.Minute(),
-			now.Second())
-		file, err := os.Create(path.Join(pathname, filename))
+		return "fatal"
+	}
+}
+
+// New pathname is the directory of the log files, stdout if empty
+func New(strLevel string, pathname string, flag int) (*Logger, error) {
+	return NewWithOptions(strLevel, pathname, flag, FileOptions{})
+}
+
+func NewWithOptions(strLevel string, pathname string, flag int, opts FileOptions) (*Logger, error) {
+	if pathname == "" {
+		return NewWithSinks(strLevel, flag, Sink{Writer: os.Stdout})
+	}
+
+	file, err := OpenFile(pathname, opts)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := NewWithSinks(strLevel, flag, Sink{Writer: file})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return logger, nil
+}
+
+// NewWithSinks the logger writes each entry to every sink whose level allows it
+func NewWithSinks(strLevel string, flag int, sinks ...Sink) (*Logger, error) {
+	// level
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// output
+	out := new(output)
+	out.encoder = TextEncoder
+	for _, s := range sinks {
+		sk, err := newSink(s)
 		if err != nil {
 			return nil, err
 		}
-
-		baseLogger = log.New(file, "", flag)
-		baseFile = file
-	} else {
-		baseLogger = log.New(os.Stdout, "", flag)
+		out.sinks = append(out.sinks, sk)
 	}
 
 	// new
 	logger := new(Logger)
-	logger.level = level
-	logger.baseLogger = baseLogger
-	logger.baseFile = baseFile
+	logger.level = &level
+	logger.flag = flag
+	logger.out = out
 
 	return logger, nil
 }
 
+// AddSink goroutine safe
+func (logger *Logger) AddSink(s Sink) error {
+	sk, err := newSink(s)
+	if err != nil {
+		return err
+	}
+
+	out, _ := logger.getOutput()
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if out.closed {
+		panic("logger closed")
+	}
+	sinks := make([]*sink, len(out.sinks), len(out.sinks)+1)
+	copy(sinks, out.sinks)
+	out.sinks = append(sinks, sk)
+	return nil
+}
+
 // Close It's dangerous to call the method on logging
+// the entries queued by an async logger are written first, then the
+// writers of the sinks are closed, except stdout and stderr
 func (logger *Logger) Close() {
-	if logger.baseFile != nil {
-		logger.baseFile.Close()
+	if logger.name != "" {
+		return
+	}
+
+	out := logger.out
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if out.closed {
+		return
+	}
+	if out.async != nil {
+		out.async.close()
+		out.dropped += out.async.dropped
+		out.async = nil
+	}
+	for _, s := range out.sinks {
+		if s.Writer == os.Stdout || s.Writer == os.Stderr {
+			continue
+		}
+		if c, ok := s.Writer.(io.Closer); ok {
+			c.Close()
+		}
+	}
+
+	out.sinks = nil
+	out.closed = true
+}
+
+// SetLevel goroutine safe
+// the level is shared with the loggers returned by With
+func (logger *Logger) SetLevel(strLevel string) error {
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return err
 	}
+	atomic.StoreInt32(logger.level, level)
+	return nil
+}
+
+// Level goroutine safe
+func (logger *Logger) Level() string {
+	return levelName(logger.getLevel())
+}
+
+func (logger *Logger) getLevel() int32 {
+	level := atomic.LoadInt32(logger.level)
+	if level < 0 {
+		level = atomic.LoadInt32(gLogger.level)
+	}
+	return level
+}
+
+func (logger *Logger) getOutput() (*output, int) {
+	if logger.name != "" {
+		return gLogger.out, gLogger.flag
+	}
+	return logger.out, logger.flag
+}
 
-	logger.baseLogger = nil
-	logger.baseFile = nil
+// SetEncoder goroutine safe
+func (logger *Logger) SetEncoder(encoder Encoder) {
+	out, _ := logger.getOutput()
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	out.encoder = encoder
+}
+
+// With a child logger adding the fields to every entry, keyvals are
+// alternating keys and values, a Field may be passed instead of a pair
+func (logger *Logger) With(keyvals ...interface{}) *Logger {
+	child := new(Logger)
+	*child = *logger
+	child.fields = appendFields(logger.fields[:len(logger.fields):len(logger.fields)], keyvals)
+	return child
+}
+
+func appendFields(fields []Field, keyvals []interface{}) []Field {
+	for i := 0; i < len(keyvals); i++ {
+		switch k := keyvals[i].(type) {
+		case Field:
+			fields = append(fields, k)
+		case string:
+			if i+1 == len(keyvals) {
+				fields = append(fields, Field{"!BADKEY", k})
+			} else {
+				fields = append(fields, Field{k, keyvals[i+1]})
+				i++
+			}
+		default:
+			fields = append(fields, Field{"!BADKEY", k})
+		}
+	}
+	return fields
 }
 
-func (logger *Logger) doPrintf(level int, printLevel string, format string, a ...interface{}) {
-	if level < logger.level {
+func (logger *Logger) enabled(level int32) bool {
+	return level >= logger.getLevel()
+}
+
+func (logger *Logger) doPrintf(level int32, format string, a ...interface{}) {
+	if !logger.enabled(level) {
 		return
 	}
-	if logger.baseLogger == nil {
-		panic("logger closed")
+	logger.output(level, time.Now(), fmt.Sprintf(format, a...), nil, 0)
+}
+
+func (logger *Logger) doPrintw(level int32, msg string, keyvals []interface{}) {
+	if !logger.enabled(level) {
+		return
 	}
+	logger.output(level, time.Now(), msg, appendFields(nil, keyvals), 0)
+}
 
-	format = printLevel + format
-	logger.baseLogger.Output(3, fmt.Sprintf(format, a...))
+// output pc is the caller, found on the stack if 0
+func (logger *Logger) output(level int32, t time.Time, msg string, fields []Field, pc uintptr) {
+	out, flag := logger.getOutput()
+	e := Entry{
+		Time:  t,
+		Level: levelName(level),
+		Msg:   msg,
+		Flag:  flag,
+	}
+	if len(logger.fields) > 0 {
+		e.Fields = append(logger.fields[:len(logger.fields):len(logger.fields)], fields...)
+	} else {
+		e.Fields = fields
+	}
+	if flag&(log.Lshortfile|log.Llongfile) != 0 {
+		if pc == 0 {
+			// runtime.Callers, output, doPrintf, Debug
+			var pcs [1]uintptr
+			runtime.Callers(4, pcs[:])
+			pc = pcs[0]
+		}
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		e.File = frame.File
+		e.Line = frame.Line
+	}
+
+	out.mutex.Lock()
+	if out.closed {
+		out.mutex.Unlock()
+		panic("logger closed")
+	}
+	if out.async != nil {
+		out.async.write(level, &e, out.sinks, out.encoder)
+	} else {
+		writeSinks(&out.buf, out.sinks, out.encoder, level, &e)
+	}
+	out.mutex.Unlock()
 
 	if level == fatalLevel {
+		logger.Flush()
 		os.Exit(1)
 	}
 }
 
 func (logger *Logger) Debug(format string, a ...interface{}) {
-	logger.doPrintf(debugLevel, printDebugLevel, format, a...)
+	logger.doPrintf(debugLevel, format, a...)
 }
 
 func (logger *Logger) Release(format string, a ...interface{}) {
-	logger.doPrintf(releaseLevel, printReleaseLevel, format, a...)
+	logger.doPrintf(releaseLevel, format, a...)
 }
 
 func (logger *Logger) Error(format string, a ...interface{}) {
-	logger.doPrintf(errorLevel, printErrorLevel, format, a...)
+	logger.doPrintf(errorLevel, format, a...)
 }
 
 func (logger *Logger) Fatal(format string, a ...interface{}) {
-	logger.doPrintf(fatalLevel, printFatalLevel, format, a...)
+	logger.doPrintf(fatalLevel, format, a...)
+}
+
+// Debugw msg with fields, keyvals as in With
+func (logger *Logger) Debugw(msg string, keyvals ...interface{}) {
+	logger.doPrintw(debugLevel, msg, keyvals)
+}
+
+func (logger *Logger) Releasew(msg string, keyvals ...interface{}) {
+	logger.doPrintw(releaseLevel, msg, keyvals)
+}
+
+func (logger *Logger) Errorw(msg string, keyvals ...interface{}) {
+	logger.doPrintw(errorLevel, msg, keyvals)
+}
+
+func (logger *Logger) Fatalw(msg string, keyvals ...interface{}) {
+	logger.doPrintw(fatalLevel, msg, keyvals)
 }
 
 var gLogger, _ = New("debug", "", log.Lshortfile|log.Ltime)
@@ -133,41 +399,88 @@ func Export(logger *Logger) {
 }
 
 func Debug(format string, a ...interface{}) {
-	gLogger.doPrintf(debugLevel, printDebugLevel, format, a...)
+	gLogger.doPrintf(debugLevel, format, a...)
 }
 
 func Release(format string, a ...interface{}) {
-	gLogger.doPrintf(releaseLevel, printReleaseLevel, format, a...)
+	gLogger.doPrintf(releaseLevel, format, a...)
 }
 
 func Error(format string, a ...interface{}) {
-	gLogger.doPrintf(errorLevel, printErrorLevel, format, a...)
+	gLogger.doPrintf(errorLevel, format, a...)
 }
 
 func Fatal(format string, a ...interface{}) {
-	gLogger.doPrintf(fatalLevel, printFatalLevel, format, a...)
+	gLogger.doPrintf(fatalLevel, format, a...)
+}
+
+func Debugw(msg string, keyvals ...interface{}) {
+	gLogger.doPrintw(debugLevel, msg, keyvals)
+}
+
+func Releasew(msg string, keyvals ...interface{}) {
+	gLogger.doPrintw(releaseLevel, msg, keyvals)
+}
+
+func Errorw(msg string, keyvals ...interface{}) {
+	gLogger.doPrintw(errorLevel, msg, keyvals)
+}
+
+func Fatalw(msg string, keyvals ...interface{}) {
+	gLogger.doPrintw(fatalLevel, msg, keyvals)
+}
+
+// With a child of the logger exported at the time of the call
+func With(keyvals ...interface{}) *Logger {
+	return gLogger.With(keyvals...)
+}
+
+func SetLevel(strLevel string) error {
+	return gLogger.SetLevel(strLevel)
+}
+
+func Level() string {
+	return gLogger.Level()
 }
 
 func Close() {
 	gLogger.Close()
 }
 
-func SwitchNewFile()  {
-	if conf.LogLevel != ""{
-		info, err := gLogger.baseFile.Stat()
-		if err == nil && info.Size() > 500 * 1024 * 1024{
-			now := time.Now()
-			filename := fmt.Sprintf("%d%02d%02d_%02d_%02d_%02d.log",
-				now.Year(),
-				now.Month(),
-				now.Day(),
-				now.Hour(),
-				now.Minute(),
-				now.Second())
-			file, err := os.Create(path.Join(conf.LogPath, filename))
-			if err == nil {
-				gLogger.baseLogger = log.New(file, "", conf.LogFlag)
-				gLogger.baseFile = file
+// Rotate goroutine safe
+// starts new log files for the sinks writing to a File
+func (logger *Logger) Rotate() error {
+	out, _ := logger.getOutput()
+	out.mutex.Lock()
+	sinks := out.sinks
+	out.mutex.Unlock()
+
+	for _, s := range sinks {
+		if f, ok := s.Writer.(*File); ok {
+			err := f.Rotate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Rotate() error {
+	return gLogger.Rotate()
+}
+
+// SwitchNewFile Deprecated: set conf.LogMaxSize or conf.LogRotate instead
+func SwitchNewFile() {
+	if conf.LogLevel != "" {
+		out := gLogger.out
+		out.mutex.Lock()
+		sinks := out.sinks
+		out.mutex.Unlock()
+
+		for _, s := range sinks {
+			if f, ok := s.Writer.(*File); ok && f.Size() > 500*1024*1024 {
+				f.Rotate()
 			}
 		}
 	}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	mutexNamed sync.Mutex
+	named      = make(map[string]*Logger)
+)
+
+// Named goroutine safe
+// the logger of a module or subsystem, the same for the same name. It
+// writes through the exported logger, with the field logger=name, and
+// follows its level until SetLevel or SetNamedLevel is called
+func Named(name string) *Logger {
+	mutexNamed.Lock()
+	defer mutexNamed.Unlock()
+
+	if logger, ok := named[name]; ok {
+		return logger
+	}
+
+	level := int32(-1)
+	logger := new(Logger)
+	logger.level = &level
+	logger.fields = []Field{{"logger", name}}
+	logger.name = name
+	named[name] = logger
+	return logger
+}
+
+// Names goroutine safe
+// the names of the named loggers, sorted
+func Names() []string {
+	mutexNamed.Lock()
+	defer mutexNamed.Unlock()
+
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetNamedLevel goroutine safe
+// an empty level makes the named logger follow the exported logger again
+func SetNamedLevel(name string, strLevel string) error {
+	logger := Named(name)
+	if strLevel == "" {
+		atomic.StoreInt32(logger.level, -1)
+		return nil
+	}
+	return logger.SetLevel(strLevel)
+}
+
+// NamedLevel goroutine safe
+// inherited is true if the named logger follows the exported logger
+func NamedLevel(name string) (level string, inherited bool, ok bool) {
+	mutexNamed.Lock()
+	logger, ok := named[name]
+	mutexNamed.Unlock()
+
+	if !ok {
+		return "", false, false
+	}
+	return logger.Level(), atomic.LoadInt32(logger.level) < 0, true
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NetWriter sends each entry to a collector over TCP (one line per entry)
+// or UDP (one datagram per entry). A broken connection is redialed on a
+// later write, at most once per RetryInterval; entries are dropped meanwhile
+type NetWriter struct {
+	// default 1 second
+	WriteTimeout  time.Duration
+	RetryInterval time.Duration
+
+	mutex    sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn
+	lastDial time.Time
+	closed   bool
+}
+
+func DialNet(network string, addr string) (*NetWriter, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return nil, errors.New("unknown log network: " + network)
+	}
+
+	w := new(NetWriter)
+	w.WriteTimeout = time.Second
+	w.RetryInterval = time.Second
+	w.network = network
+	w.addr = addr
+	w.lastDial = time.Now()
+	conn, err := net.DialTimeout(network, addr, w.WriteTimeout)
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+	return w, nil
+}
+
+// Write goroutine safe
+func (w *NetWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.conn == nil {
+		if time.Since(w.lastDial) < w.RetryInterval {
+			return 0, errors.New("log collector unreachable: " + w.addr)
+		}
+		w.lastDial = time.Now()
+		conn, err := net.DialTimeout(w.network, w.addr, w.WriteTimeout)
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+
+	w.conn.SetWriteDeadline(time.Now().Add(w.WriteTimeout))
+	n, err := w.conn.Write(p)
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return n, err
+}
+
+// Close goroutine safe
+func (w *NetWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslog severities of the levels
+var syslogSeverities = [...]int{debugLevel: 7, releaseLevel: 6, errorLevel: 3, fatalLevel: 2}
+
+// NewSyslogEncoder frames the entries encoded by encoder as RFC 5424 syslog
+// messages, facility is 0 to 23 (16 is local0), tag defaults to the name
+// of the program
+func NewSyslogEncoder(encoder Encoder, facility int, tag string) Encoder {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	pid := strconv.Itoa(os.Getpid())
+
+	return EncoderFunc(func(buf *bytes.Buffer, e *Entry) {
+		level, err := parseLevel(e.Level)
+		if err != nil {
+			level = releaseLevel
+		}
+		buf.WriteByte('<')
+		buf.WriteString(strconv.Itoa(facility*8 + syslogSeverities[level]))
+		buf.WriteString(">1 ")
+		buf.WriteString(e.Time.UTC().Format("2006-01-02T15:04:05.000000Z"))
+		buf.WriteByte(' ')
+		buf.WriteString(hostname)
+		buf.WriteByte(' ')
+		buf.WriteString(tag)
+		buf.WriteByte(' ')
+		buf.WriteString(pid)
+		buf.WriteString(" - - ")
+
+		// the time is in the header already
+		e2 := *e
+		e2.Flag &^= timeFlags
+		encoder.Encode(buf, &e2)
+	})
+}
@@ -0,0 +1,94 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type handler struct {
+	logger *Logger
+	group  string
+	fields []Field
+}
+
+// NewHandler a slog.Handler writing through the logger, with its level,
+// encoder and file. A nil logger is the one exported at the time of each call
+//
+//	slog.SetDefault(slog.New(log.NewHandler(nil)))
+func NewHandler(logger *Logger) slog.Handler {
+	return &handler{logger: logger}
+}
+
+func (h *handler) getLogger() *Logger {
+	if h.logger != nil {
+		return h.logger
+	}
+	return gLogger
+}
+
+// slog.LevelWarn and slog.LevelInfo are both release
+func slogLevel(level slog.Level) int32 {
+	switch {
+	case level < slog.LevelInfo:
+		return debugLevel
+	case level < slog.LevelError:
+		return releaseLevel
+	default:
+		return errorLevel
+	}
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.getLogger().enabled(slogLevel(level))
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	fields := h.fields[:len(h.fields):len(h.fields)]
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.group, a)
+		return true
+	})
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	h.getLogger().output(slogLevel(r.Level), t, r.Message, fields, r.PC)
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.fields = h.fields[:len(h.fields):len(h.fields)]
+	for _, a := range attrs {
+		h2.fields = appendAttr(h2.fields, h.group, a)
+	}
+	return &h2
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+// appendAttr groups are flattened into dotted keys
+func appendAttr(fields []Field, group string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, group, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{group + a.Key, a.Value.Any()})
+}
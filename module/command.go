@@ -0,0 +1,116 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zfiona/server-base/chanrpc"
+	"github.com/zfiona/server-base/conf"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the calls queued on the command server of a skeleton
+const commandLen = 16
+
+// ErrBusy the module has not run the command within conf.CommandTimeout
+var ErrBusy = errors.New("module busy")
+
+// Command a command registered by Skeleton.RegisterCommand
+// name may contain spaces to group commands, e.g. "game reloadconfig"
+type Command struct {
+	Name   string
+	Help   string
+	server *chanrpc.Server
+}
+
+var commands = struct {
+	sync.RWMutex
+	m map[string]*Command
+}{m: make(map[string]*Command)}
+
+func registerCommand(c *Command) {
+	commands.Lock()
+	defer commands.Unlock()
+
+	if _, ok := commands.m[c.Name]; ok {
+		panic(fmt.Sprintf("command %v: already registered", c.Name))
+	}
+	commands.m[c.Name] = c
+}
+
+func unregisterCommands(server *chanrpc.Server) {
+	commands.Lock()
+	defer commands.Unlock()
+
+	for name, c := range commands.m {
+		if c.server == server {
+			delete(commands.m, name)
+		}
+	}
+}
+
+// Commands goroutine safe, sorted by name
+func Commands() []*Command {
+	commands.RLock()
+	defer commands.RUnlock()
+
+	cs := make([]*Command, 0, len(commands.m))
+	for _, c := range commands.m {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].Name < cs[j].Name
+	})
+	return cs
+}
+
+// LookupCommand goroutine safe
+// returns the command with the longest name matching the leading fields
+// and the remaining fields as its arguments
+func LookupCommand(fields []string) (*Command, []string) {
+	commands.RLock()
+	defer commands.RUnlock()
+
+	for n := len(fields); n > 0; n-- {
+		if c, ok := commands.m[strings.Join(fields[:n], " ")]; ok {
+			return c, fields[n:]
+		}
+	}
+	return nil, nil
+}
+
+// Exec goroutine safe
+// the command runs on the goroutine of the module which registered it,
+// ErrBusy if it has not run within conf.CommandTimeout. It is then skipped
+func (c *Command) Exec(args []string) (string, error) {
+	var ret interface{}
+	var err error
+	abandoned := new(int32)
+	client := chanrpc.NewClient(1)
+	client.Attach(c.server)
+	client.AsyncCall(c.Name, args, abandoned, func(r interface{}, e error) {
+		ret, err = r, e
+	})
+
+	if conf.CommandTimeout > 0 {
+		t := time.NewTimer(conf.CommandTimeout)
+		defer t.Stop()
+		select {
+		case ri := <-client.ChanAsyncRet:
+			client.Cb(ri)
+		case <-t.C:
+			atomic.StoreInt32(abandoned, 1)
+			return "", ErrBusy
+		}
+	} else {
+		client.Cb(<-client.ChanAsyncRet)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return ret.(string), nil
+}
@@ -0,0 +1,393 @@
+package module_test
+
+import (
+	"fmt"
+	"github.com/zfiona/server-base/chanrpc"
+	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/module"
+	"github.com/zfiona/server-base/module/testdata/game"
+	"github.com/zfiona/server-base/module/testdata/gate"
+	"github.com/zfiona/server-base/timer"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func ExampleSkeleton_RegisterCommand() {
+	s := new(module.Skeleton)
+	s.Init()
+
+	count := 0
+	s.RegisterCommand("game count", "add up the arguments", func(args []string) string {
+		count += len(args)
+		return fmt.Sprintf("count=%v", count)
+	})
+
+	closeSig := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+
+	c, args := module.LookupCommand(strings.Fields("game count a b"))
+	fmt.Println(c.Name, args)
+	fmt.Println(c.Exec(args))
+
+	for _, c := range module.Commands() {
+		fmt.Println(c.Name, "-", c.Help)
+	}
+
+	closeSig <- true
+	<-done
+	c, _ = module.LookupCommand([]string{"game", "count"})
+	fmt.Println(c == nil)
+
+	// Output:
+	// game count [a b]
+	// count=2 <nil>
+	// game count - add up the arguments
+	// true
+}
+
+func ExampleSkeleton_clock() {
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 1,
+		23, 0, 0,
+		0, time.UTC,
+	))
+	s := &module.Skeleton{
+		TimerDispatcherLen: 10,
+		Clock:              clock,
+		ChanRPCServer:      chanrpc.NewServer(10),
+	}
+	s.Init()
+
+	// both on the goroutine of the skeleton
+	gold := 0
+	s.RegisterChanRPC("AddGold", func(args []interface{}) interface{} {
+		gold += args[0].(int)
+		return gold
+	})
+	cronExpr, err := timer.NewCronExpr("@daily")
+	if err != nil {
+		return
+	}
+	reset := make(chan struct{})
+	s.CronFunc(cronExpr, func() {
+		gold = 0
+		fmt.Println("daily reset", s.Now())
+		reset <- struct{}{}
+	})
+
+	closeSig := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+
+	fmt.Println(s.ChanRPCServer.Call1("AddGold", 100))
+	for i := 0; i < 2; i++ {
+		next, _ := clock.Next()
+		clock.Advance(next.Sub(clock.Now()))
+		<-reset
+		fmt.Println(s.ChanRPCServer.Call1("AddGold", 10))
+	}
+
+	closeSig <- true
+	<-done
+
+	// Output:
+	// 100 <nil>
+	// daily reset 2000-01-02 00:00:00 +0000 UTC
+	// 10 <nil>
+	// daily reset 2000-01-03 00:00:00 +0000 UTC
+	// 10 <nil>
+}
+
+func ExampleCommand_Exec() {
+	conf.CommandTimeout = 50 * time.Millisecond
+	defer func() {
+		conf.CommandTimeout = 10 * time.Second
+	}()
+
+	s := new(module.Skeleton)
+	s.Init()
+	s.RegisterCommand("game stuck", "", func(args []string) string {
+		fmt.Println("run", args)
+		return "done"
+	})
+
+	// the module is not running yet
+	c, args := module.LookupCommand([]string{"game", "stuck", "1"})
+	_, err := c.Exec(args)
+	fmt.Println(err)
+
+	closeSig := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+
+	// the first call is skipped
+	fmt.Println(c.Exec([]string{"2"}))
+
+	closeSig <- true
+	<-done
+
+	// Output:
+	// module busy
+	// run [2]
+	// done <nil>
+}
+
+type exampleModule struct {
+	name string
+	deps []string
+}
+
+func (m *exampleModule) Name() string        { return m.name }
+func (m *exampleModule) DependsOn() []string { return m.deps }
+func (m *exampleModule) OnInit()             { fmt.Println("init", m.name) }
+func (m *exampleModule) OnDestroy()          { fmt.Println("destroy", m.name) }
+func (m *exampleModule) Run(closeSig chan bool) {
+	<-closeSig
+}
+
+func ExampleInit() {
+	module.Reset()
+	module.Register(&exampleModule{name: "gate", deps: []string{"game", "login"}})
+	module.Register(&exampleModule{name: "game", deps: []string{"db"}})
+	module.Register(&exampleModule{name: "login", deps: []string{"db"}})
+	module.Register(&exampleModule{name: "db"})
+
+	module.Init()
+	state, _ := module.StateOf("game")
+	fmt.Println(state)
+
+	module.Destroy()
+	for _, s := range module.Statuses() {
+		fmt.Println(s.Name, s.State)
+	}
+
+	// Output:
+	// init db
+	// init game
+	// init login
+	// init gate
+	// running
+	// destroy gate
+	// destroy login
+	// destroy game
+	// destroy db
+	// db stopped
+	// game stopped
+	// login stopped
+	// gate stopped
+}
+
+func ExampleRegister() {
+	module.Reset()
+
+	// both of type *internal.Module
+	module.Register(game.Module)
+	module.Register(gate.Module)
+	module.Register(&exampleModule{name: "login"})
+
+	module.Init()
+	for _, s := range module.Statuses() {
+		fmt.Println(s.Name, s.State)
+	}
+	module.Destroy()
+
+	// Output:
+	// init game
+	// init gate
+	// init login
+	// github.com/zfiona/server-base/module/testdata/game/internal.Module running
+	// github.com/zfiona/server-base/module/testdata/gate/internal.Module running
+	// login running
+	// destroy login
+	// destroy gate
+	// destroy game
+}
+
+// a gate, its connections are drained before any module is stopped
+type drainModule struct {
+	exampleModule
+	conns int32
+}
+
+func (m *drainModule) OnPreStop() {
+	fmt.Println("prestop", m.name)
+	for atomic.LoadInt32(&m.conns) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Println("drained", m.name)
+}
+
+func (m *drainModule) Run(closeSig chan bool) {
+	<-closeSig
+	fmt.Println("closed", m.name, "with", atomic.LoadInt32(&m.conns), "connections")
+}
+
+// a module which does not stop in time
+type stuckModule struct {
+	exampleModule
+	release chan struct{}
+}
+
+func (m *stuckModule) OnPreStop() {
+	fmt.Println("prestop", m.name)
+}
+
+func (m *stuckModule) ShutdownTimeout() time.Duration {
+	return 50 * time.Millisecond
+}
+
+func (m *stuckModule) Run(closeSig chan bool) {
+	<-closeSig
+	<-m.release
+}
+
+func ExampleDestroy() {
+	module.Reset()
+
+	gate := &drainModule{exampleModule: exampleModule{name: "gate", deps: []string{"game"}}, conns: 3}
+	game := &stuckModule{exampleModule: exampleModule{name: "game", deps: []string{"db"}}, release: make(chan struct{})}
+	defer close(game.release)
+	module.Register(gate)
+	module.Register(game)
+	module.Register(&exampleModule{name: "db"})
+
+	module.Init()
+
+	// the connections close one by one
+	go func() {
+		for atomic.LoadInt32(&gate.conns) > 0 {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&gate.conns, -1)
+		}
+	}()
+
+	module.Destroy()
+	for _, s := range module.Statuses() {
+		fmt.Println(s.Name, s.State)
+	}
+
+	// Output:
+	// init db
+	// init game
+	// init gate
+	// prestop gate
+	// drained gate
+	// prestop game
+	// closed gate with 0 connections
+	// destroy gate
+	// destroy db
+	// db stopped
+	// game failed
+	// gate stopped
+}
+
+// a module whose Run panics the first panics times
+type panicModule struct {
+	exampleModule
+	supervisor module.Supervisor
+	panics     int32
+	runs       int32
+}
+
+func (m *panicModule) OnInit() {}
+
+func (m *panicModule) OnDestroy() {}
+
+func (m *panicModule) Supervisor() module.Supervisor {
+	return m.supervisor
+}
+
+func (m *panicModule) Run(closeSig chan bool) {
+	if atomic.AddInt32(&m.runs, 1) <= m.panics {
+		panic("run " + m.name)
+	}
+	<-closeSig
+}
+
+// wait until the module has run n times and is in state
+func (m *panicModule) wait(n int32, state module.State) {
+	for {
+		s, _ := module.StateOf(m.name)
+		if atomic.LoadInt32(&m.runs) == n && s == state {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func ExampleSupervisor() {
+	module.Reset()
+
+	restart := module.Supervisor{
+		Policy:      module.PolicyRestart,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+		MaxRestarts: 2,
+	}
+	flaky := &panicModule{exampleModule: exampleModule{name: "flaky"}, supervisor: restart, panics: 2}
+	broken := &panicModule{exampleModule: exampleModule{name: "broken"}, supervisor: restart, panics: 100}
+	optional := &panicModule{exampleModule: exampleModule{name: "optional"}, supervisor: module.Supervisor{Policy: module.PolicyIgnore}, panics: 100}
+	module.Register(flaky)
+	module.Register(broken)
+	module.Register(optional)
+
+	module.Init()
+	// restarted twice, running
+	flaky.wait(3, module.StateRunning)
+	// restarted twice, given up
+	broken.wait(3, module.StateFailed)
+	// not restarted
+	optional.wait(1, module.StateFailed)
+
+	for _, s := range module.Statuses() {
+		fmt.Println(s.Name, s.State)
+	}
+	module.Destroy()
+	for _, s := range module.Statuses() {
+		fmt.Println(s.Name, s.State)
+	}
+	fmt.Println("runs", flaky.runs, broken.runs, optional.runs)
+
+	// Output:
+	// flaky running
+	// broken failed
+	// optional failed
+	// flaky stopped
+	// broken failed
+	// optional failed
+	// runs 3 3 1
+}
+
+func ExampleSupervisor_escalate() {
+	// the module in a process of its own, exited by the panic
+	if os.Getenv("MODULE_ESCALATE") == "1" {
+		module.Reset()
+		module.Register(&panicModule{exampleModule: exampleModule{name: "fatal"}, panics: 1})
+		module.Init()
+		time.Sleep(10 * time.Second)
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^ExampleSupervisor_escalate$")
+	cmd.Env = append(os.Environ(), "MODULE_ESCALATE=1")
+	out, err := cmd.Output()
+	fmt.Println(err)
+	fmt.Println(strings.Contains(string(out), "module fatal: run panicked"))
+
+	// Output:
+	// exit status 1
+	// true
+}
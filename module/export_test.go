@@ -0,0 +1,7 @@
+package module
+
+// Reset unregisters all the modules, every example registering modules
+// starts with it
+func Reset() {
+	mods = nil
+}
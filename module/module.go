@@ -1,10 +1,15 @@
 package module
 
 import (
+	"fmt"
 	"github.com/zfiona/server-base/conf"
 	"github.com/zfiona/server-base/log"
+	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Module interface {
@@ -13,8 +18,103 @@ type Module interface {
 	Run(closeSig chan bool)
 }
 
+// Named optional, the name defaults to the package path and the name of the
+// type of the module, followed by #index if the type is registered again
+type Named interface {
+	Name() string
+}
+
+// Dependent optional, names of the modules to be initialized before
+// and destroyed after the module
+type Dependent interface {
+	DependsOn() []string
+}
+
+// PreStopper optional, OnPreStop is called on every module in reverse order
+// before any module is destroyed, e.g. gates stop accepting connections
+type PreStopper interface {
+	OnPreStop()
+}
+
+// ShutdownTimeouter optional, overrides conf.ModuleShutdownTimeout
+type ShutdownTimeouter interface {
+	ShutdownTimeout() time.Duration
+}
+
+type RestartPolicy int
+
+const (
+	// PolicyEscalate logs the panic and exits the process
+	PolicyEscalate RestartPolicy = iota
+	// PolicyRestart calls Run again after a backoff
+	PolicyRestart
+	// PolicyIgnore leaves the module in StateFailed
+	PolicyIgnore
+)
+
+// Supervisor what to do when Run of a module panics
+type Supervisor struct {
+	Policy RestartPolicy
+	// PolicyRestart only, the backoff (default 1s) doubles after every
+	// restart up to MaxBackoff (default 1m) and resets when Run has lasted
+	// longer than MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// PolicyRestart only, give up and leave the module in StateFailed
+	// after MaxRestarts consecutive restarts, 0 means no limit
+	MaxRestarts int
+}
+
+// Supervised optional, modules are supervised with PolicyEscalate by default
+type Supervised interface {
+	Supervisor() Supervisor
+}
+
+type State int32
+
+const (
+	StateRegistered State = iota
+	StateInitializing
+	StateRunning
+	StateStopping
+	StateStopped
+	StateFailed
+	StateRestarting
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateInitializing:
+		return "initializing"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	case StateRestarting:
+		return "restarting"
+	default:
+		return fmt.Sprintf("State(%d)", int32(s))
+	}
+}
+
+type Status struct {
+	Name      string
+	DependsOn []string
+	State     State
+}
+
 type module struct {
 	mi       Module
+	name     string
+	named    bool
+	deps     []string
+	state    int32
 	closeSig chan bool
 	wg       sync.WaitGroup
 }
@@ -24,40 +124,317 @@ var mods []*module
 func Register(mi Module) {
 	m := new(module)
 	m.mi = mi
+	m.name = typeName(mi)
+	if n, ok := mi.(Named); ok {
+		m.name = n.Name()
+		m.named = true
+	}
+	if d, ok := mi.(Dependent); ok {
+		m.deps = d.DependsOn()
+	}
 	m.closeSig = make(chan bool, 1)
 
+	for i := 0; i < len(mods); i++ {
+		if mods[i].name != m.name {
+			continue
+		}
+		switch {
+		case m.named && mods[i].named:
+			panic(fmt.Sprintf("module %v: already registered", m.name))
+		case m.named:
+			mods[i].name += fmt.Sprintf("#%v", i)
+		default:
+			m.name += fmt.Sprintf("#%v", len(mods))
+		}
+	}
+
 	mods = append(mods, m)
 }
 
+// typeName the package path and the name of the type of mi, *internal.Module
+// of game/internal and gate/internal differ
+func typeName(mi Module) string {
+	t := reflect.TypeOf(mi)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" || t.Name() == "" {
+		return fmt.Sprintf("%T", mi)
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// Modules returns the registered modules in initialization order
+func Modules() []Module {
+	mis := make([]Module, len(mods))
+	for i := 0; i < len(mods); i++ {
+		mis[i] = mods[i].mi
+	}
+	return mis
+}
+
+// Statuses goroutine safe, in initialization order
+func Statuses() []Status {
+	ss := make([]Status, len(mods))
+	for i := 0; i < len(mods); i++ {
+		ss[i] = Status{
+			Name:      mods[i].name,
+			DependsOn: mods[i].deps,
+			State:     mods[i].getState(),
+		}
+	}
+	return ss
+}
+
+// StateOf goroutine safe
+func StateOf(name string) (State, bool) {
+	for i := 0; i < len(mods); i++ {
+		if mods[i].name == name {
+			return mods[i].getState(), true
+		}
+	}
+	return StateRegistered, false
+}
+
+func (m *module) getState() State {
+	return State(atomic.LoadInt32(&m.state))
+}
+
+func (m *module) setState(s State) {
+	atomic.StoreInt32(&m.state, int32(s))
+}
+
+func (m *module) casState(old State, new State) bool {
+	return atomic.CompareAndSwapInt32(&m.state, int32(old), int32(new))
+}
+
+// sort modules so that every module comes after its dependencies,
+// keeping the registration order otherwise
+func sortMods() {
+	byName := make(map[string]*module)
+	for i := 0; i < len(mods); i++ {
+		byName[mods[i].name] = mods[i]
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[*module]int)
+	sorted := make([]*module, 0, len(mods))
+	var path []string
+
+	var visit func(m *module)
+	visit = func(m *module) {
+		switch marks[m] {
+		case visited:
+			return
+		case visiting:
+			for i := 0; i < len(path); i++ {
+				if path[i] == m.name {
+					panic(fmt.Sprintf("module dependency cycle: %v -> %v",
+						strings.Join(path[i:], " -> "), m.name))
+				}
+			}
+		}
+
+		marks[m] = visiting
+		path = append(path, m.name)
+		for _, dep := range m.deps {
+			d, ok := byName[dep]
+			if !ok {
+				panic(fmt.Sprintf("module %v: unknown dependency %v", m.name, dep))
+			}
+			visit(d)
+		}
+		path = path[:len(path)-1]
+		marks[m] = visited
+
+		sorted = append(sorted, m)
+	}
+
+	for i := 0; i < len(mods); i++ {
+		visit(mods[i])
+	}
+	mods = sorted
+}
+
 func Init() {
+	sortMods()
+
 	for i := 0; i < len(mods); i++ {
+		mods[i].setState(StateInitializing)
 		mods[i].mi.OnInit()
 	}
 
 	for i := 0; i < len(mods); i++ {
 		m := mods[i]
 		m.wg.Add(1)
+		m.setState(StateRunning)
 		go run(m)
 	}
 }
 
 func Destroy() {
+	for i := len(mods) - 1; i >= 0; i-- {
+		if p, ok := mods[i].mi.(PreStopper); ok {
+			preStop(p)
+		}
+	}
+
 	for i := len(mods) - 1; i >= 0; i-- {
 		m := mods[i]
+		if m.getState() != StateFailed {
+			m.setState(StateStopping)
+		}
 		m.closeSig <- true
-		m.wg.Wait()
+
+		timeout := conf.ModuleShutdownTimeout
+		if t, ok := m.mi.(ShutdownTimeouter); ok {
+			timeout = t.ShutdownTimeout()
+		}
+		if !m.wait(timeout) {
+			m.setState(StateFailed)
+			log.Error("module %v: not stopped in %v, skipped", m.name, timeout)
+			continue
+		}
+
 		destroy(m)
 	}
 }
 
+// wait for Run to return, no timeout if timeout <= 0
+func (m *module) wait(timeout time.Duration) bool {
+	if timeout <= 0 {
+		m.wg.Wait()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
 func run(m *module) {
+	defer m.wg.Done()
+
+	var s Supervisor
+	if sv, ok := m.mi.(Supervised); ok {
+		s = sv.Supervisor()
+	}
+	if s.Backoff <= 0 {
+		s.Backoff = time.Second
+	}
+	if s.MaxBackoff <= 0 {
+		s.MaxBackoff = time.Minute
+	}
+	if s.MaxBackoff < s.Backoff {
+		s.MaxBackoff = s.Backoff
+	}
+
+	backoff := s.Backoff
+	restarts := 0
+	for {
+		start := time.Now()
+		if !runSafe(m) {
+			return
+		}
+		if !m.casState(StateRunning, StateFailed) {
+			// panicked while stopping
+			m.setState(StateFailed)
+			return
+		}
+
+		switch s.Policy {
+		case PolicyIgnore:
+			return
+		case PolicyRestart:
+		default:
+			log.Fatal("module %v: run panicked", m.name)
+		}
+
+		if time.Since(start) > s.MaxBackoff {
+			backoff = s.Backoff
+			restarts = 0
+		}
+		if s.MaxRestarts > 0 && restarts >= s.MaxRestarts {
+			log.Error("module %v: restarted %v times, given up", m.name, restarts)
+			return
+		}
+		restarts++
+
+		if !m.casState(StateFailed, StateRestarting) {
+			return
+		}
+		log.Release("module %v: restarting in %v", m.name, backoff)
+		t := time.NewTimer(backoff)
+		select {
+		case <-m.closeSig:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if !m.casState(StateRestarting, StateRunning) {
+			return
+		}
+
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// runSafe returns true if Run panicked
+func runSafe(m *module) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("module %v: %v: %s", m.name, r, buf[:l])
+			} else {
+				log.Error("module %v: %v", m.name, r)
+			}
+		}
+	}()
+
 	m.mi.Run(m.closeSig)
-	m.wg.Done()
+	return
+}
+
+func preStop(p PreStopper) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+		}
+	}()
+
+	p.OnPreStop()
 }
 
 func destroy(m *module) {
 	defer func() {
 		if r := recover(); r != nil {
+			m.setState(StateFailed)
 			if conf.LenStackBuf > 0 {
 				buf := make([]byte, conf.LenStackBuf)
 				l := runtime.Stack(buf, false)
@@ -69,4 +446,5 @@ func destroy(m *module) {
 	}()
 
 	m.mi.OnDestroy()
+	m.casState(StateStopping, StateStopped)
 }
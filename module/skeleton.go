@@ -4,6 +4,8 @@ import (
 	"github.com/zfiona/server-base/chanrpc"
 	"github.com/zfiona/server-base/go"
 	"github.com/zfiona/server-base/timer"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,6 +13,8 @@ type Skeleton struct {
 	GoLen              int
 	TimerDispatcherLen int
 	AsyncCallLen       int
+	TimerWheelTick     time.Duration // 0 uses runtime timers, otherwise a timing wheel
+	Clock              timer.Clock   // nil uses timer.RealClock
 	ChanRPCServer      *chanrpc.Server
 	g                  *g.Go
 	dispatcher         *timer.Dispatcher
@@ -31,22 +35,31 @@ func (s *Skeleton) Init() {
 	}
 
 	s.g = g.New(s.GoLen)
-	s.dispatcher = timer.NewDispatcher(s.TimerDispatcherLen)
+	if s.Clock == nil {
+		s.Clock = timer.RealClock
+	}
+	if s.TimerWheelTick > 0 {
+		s.dispatcher = timer.NewWheelDispatcherWithClock(s.TimerDispatcherLen, s.TimerWheelTick, s.Clock)
+	} else {
+		s.dispatcher = timer.NewDispatcherWithClock(s.TimerDispatcherLen, s.Clock)
+	}
 	s.client = chanrpc.NewClient(s.AsyncCallLen)
 	s.server = s.ChanRPCServer
 
 	if s.server == nil {
 		s.server = chanrpc.NewServer(0)
 	}
-	s.commandServer = chanrpc.NewServer(0)
+	s.commandServer = chanrpc.NewServer(commandLen)
 }
 
 func (s *Skeleton) Run(closeSig chan bool) {
 	for {
 		select {
 		case <-closeSig:
+			unregisterCommands(s.commandServer)
 			s.commandServer.Close()
 			s.server.Close()
+			s.dispatcher.Close()
 			for !s.g.Idle() || !s.client.Idle() {
 				s.g.Close()
 				s.client.Close()
@@ -66,6 +79,11 @@ func (s *Skeleton) Run(closeSig chan bool) {
 	}
 }
 
+// Now the time of the clock of the skeleton
+func (s *Skeleton) Now() time.Time {
+	return s.Clock.Now()
+}
+
 func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	if s.TimerDispatcherLen == 0 {
 		panic("invalid TimerDispatcherLen")
@@ -82,6 +100,14 @@ func (s *Skeleton) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
 	return s.dispatcher.CronFunc(cronExpr, cb)
 }
 
+func (s *Skeleton) TickerFunc(d time.Duration, mode timer.TickerMode, cb func(missed int)) *timer.Ticker {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.TickerFunc(d, mode, cb)
+}
+
 func (s *Skeleton) Go(f func(), cb func()) {
 	if s.GoLen == 0 {
 		panic("invalid GoLen")
@@ -113,3 +139,28 @@ func (s *Skeleton) RegisterChanRPC(id interface{}, f interface{}) {
 	}
 	s.server.Register(id, f)
 }
+
+// RegisterCommand you must call the function before calling Run
+// f runs on the goroutine of the module, args excludes the command name
+func (s *Skeleton) RegisterCommand(name string, help string, f func(args []string) string) {
+	if s.commandServer == nil {
+		panic("invalid commandServer")
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		panic("invalid command name")
+	}
+
+	s.commandServer.Register(name, func(args []interface{}) interface{} {
+		// Exec has given up
+		if atomic.LoadInt32(args[1].(*int32)) != 0 {
+			return ""
+		}
+		return f(args[0].([]string))
+	})
+	registerCommand(&Command{
+		Name:   name,
+		Help:   help,
+		server: s.commandServer,
+	})
+}
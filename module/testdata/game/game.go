@@ -0,0 +1,8 @@
+// Package game a module of the leaf layout, for the examples
+package game
+
+import (
+	"github.com/zfiona/server-base/module/testdata/game/internal"
+)
+
+var Module = new(internal.Module)
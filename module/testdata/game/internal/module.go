@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"fmt"
+)
+
+type Module struct{}
+
+func (m *Module) OnInit() {
+	fmt.Println("init game")
+}
+
+func (m *Module) OnDestroy() {
+	fmt.Println("destroy game")
+}
+
+func (m *Module) Run(closeSig chan bool) {
+	<-closeSig
+}
@@ -0,0 +1,8 @@
+// Package gate a module of the leaf layout, for the examples
+package gate
+
+import (
+	"github.com/zfiona/server-base/module/testdata/gate/internal"
+)
+
+var Module = new(internal.Module)
@@ -0,0 +1,17 @@
+package network
+
+import (
+	"sync/atomic"
+)
+
+var connNum int32
+
+// AddConnNum goroutine safe
+func AddConnNum(delta int32) {
+	atomic.AddInt32(&connNum, delta)
+}
+
+// ConnNum goroutine safe, the number of connections of all servers
+func ConnNum() int32 {
+	return atomic.LoadInt32(&connNum)
+}
@@ -15,6 +15,7 @@ type Server struct {
 	MaxConnNum      int32
 	PendingWriteNum int32
 	ln              net.Listener
+	connNum         int32
 	waitGroup        *sync.WaitGroup
 	exitChan         chan struct{}
 
@@ -90,12 +91,24 @@ func (s *Server) run() {
 
 func (s *Server) setConnsNum(num int32) {
 	atomic.AddInt32(&s.MaxConnNum,num)
+	atomic.AddInt32(&s.connNum, -num)
+	network.AddConnNum(-num)
 }
 
 func (s *Server) getConnsNum() int32 {
 	return atomic.LoadInt32(&s.MaxConnNum)
 }
 
+// ConnNum goroutine safe, the number of connections of the server
+func (s *Server) ConnNum() int32 {
+	return atomic.LoadInt32(&s.connNum)
+}
+
+// StopAccept stops accepting new connections, existing ones are kept
+func (s *Server) StopAccept() {
+	_ = s.ln.Close()
+}
+
 func (s *Server) Close() {
 	close(s.exitChan)
 	_= s.ln.Close()
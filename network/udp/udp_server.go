@@ -19,6 +19,7 @@ type Server struct {
 	ConnReadTimeout  time.Duration // read timeout
 	ConnWriteTimeout time.Duration // write timeout
 	ln               net.Listener
+	connNum          int32
 	waitGroup        *sync.WaitGroup
 	exitChan         chan struct{}
 
@@ -105,12 +106,24 @@ func setKcpSetting(conn net.Conn)  {
 
 func (s *Server) setConnsNum(num int32) {
 	atomic.AddInt32(&s.MaxConnNum,num)
+	atomic.AddInt32(&s.connNum, -num)
+	network.AddConnNum(-num)
 }
 
 func (s *Server) getConnsNum() int32 {
 	return atomic.LoadInt32(&s.MaxConnNum)
 }
 
+// ConnNum goroutine safe, the number of connections of the server
+func (s *Server) ConnNum() int32 {
+	return atomic.LoadInt32(&s.connNum)
+}
+
+// StopAccept stops accepting new connections, existing ones are kept
+func (s *Server) StopAccept() {
+	_ = s.ln.Close()
+}
+
 func (s *Server) Close() {
 	close(s.exitChan)
 	_=s.ln.Close()
@@ -22,6 +22,7 @@ type Server struct {
 	CertFile        string
 	KeyFile         string
 	ln              net.Listener
+	connNum         int32
 	handler         *WSHandler
 
 	exitChan  chan struct{}
@@ -116,6 +117,16 @@ func (s *Server) Start() {
 	}()
 }
 
+// ConnNum goroutine safe, the number of connections of the server
+func (s *Server) ConnNum() int32 {
+	return atomic.LoadInt32(&s.connNum)
+}
+
+// StopAccept stops accepting new connections, existing ones are kept
+func (s *Server) StopAccept() {
+	_ = s.ln.Close()
+}
+
 func (s *Server) Close() {
 	close(s.exitChan)
 	_= s.ln.Close()
@@ -124,6 +135,8 @@ func (s *Server) Close() {
 
 func (s *Server) setConnsNum(num int32) {
 	atomic.AddInt32(&s.MaxConnNum,num)
+	atomic.AddInt32(&s.connNum, -num)
+	network.AddConnNum(-num)
 }
 
 func (s *Server) getConnsNum() int32 {
@@ -0,0 +1,314 @@
+package recordfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// the binary encoding of the records in a snapshot, by kind:
+//
+//	bool                 one byte
+//	int8 to int64        zigzag varint
+//	uint8 to uint64      varint
+//	float32, float64     little endian IEEE 754 bits
+//	string               varint length and bytes
+//	array                the elements
+//	slice, map           varint length+1, 0 for nil, and the elements
+//	struct               the exported fields in order
+//
+// other kinds, such as interfaces and pointers, are not supported
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errShort = errors.New("unexpected end of snapshot")
+
+func (d *decoder) uint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail(errShort)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if n > len(d.buf) {
+		d.fail(errShort)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// len of a string, at most the bytes left
+func (d *decoder) len() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.fail(errShort)
+		return 0
+	}
+	return int(n)
+}
+
+// lenNil of a slice or a map, -1 for nil
+func (d *decoder) lenNil() int {
+	n := d.uint()
+	if n == 0 {
+		return -1
+	}
+	if n-1 > uint64(len(d.buf)) {
+		d.fail(errShort)
+		return -1
+	}
+	return int(n - 1)
+}
+
+// the decoding stops at the first error
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.buf = nil
+}
+
+type encodeFunc func(e *encoder, v reflect.Value)
+type decodeFunc func(d *decoder, v reflect.Value)
+
+func unsupported(t reflect.Type) error {
+	return fmt.Errorf("unsupported type %v", t)
+}
+
+func encoderOf(t reflect.Type) (encodeFunc, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(e *encoder, v reflect.Value) {
+			if v.Bool() {
+				e.buf = append(e.buf, 1)
+			} else {
+				e.buf = append(e.buf, 0)
+			}
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(e *encoder, v reflect.Value) {
+			e.buf = binary.AppendVarint(e.buf, v.Int())
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(e *encoder, v reflect.Value) {
+			e.uint(v.Uint())
+		}, nil
+	case reflect.Float32:
+		return func(e *encoder, v reflect.Value) {
+			e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+		}, nil
+	case reflect.Float64:
+		return func(e *encoder, v reflect.Value) {
+			e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+		}, nil
+	case reflect.String:
+		return func(e *encoder, v reflect.Value) {
+			e.uint(uint64(v.Len()))
+			e.buf = append(e.buf, v.String()...)
+		}, nil
+	case reflect.Array:
+		encodeElem, err := encoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(e *encoder, v reflect.Value) {
+			for i := 0; i < v.Len(); i++ {
+				encodeElem(e, v.Index(i))
+			}
+		}, nil
+	case reflect.Slice:
+		encodeElem, err := encoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(e *encoder, v reflect.Value) {
+			if v.IsNil() {
+				e.uint(0)
+				return
+			}
+			e.uint(uint64(v.Len()) + 1)
+			for i := 0; i < v.Len(); i++ {
+				encodeElem(e, v.Index(i))
+			}
+		}, nil
+	case reflect.Map:
+		encodeKey, err := encoderOf(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		encodeElem, err := encoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(e *encoder, v reflect.Value) {
+			if v.IsNil() {
+				e.uint(0)
+				return
+			}
+			e.uint(uint64(v.Len()) + 1)
+			iter := v.MapRange()
+			for iter.Next() {
+				encodeKey(e, iter.Key())
+				encodeElem(e, iter.Value())
+			}
+		}, nil
+	case reflect.Struct:
+		fields, encodes := []int(nil), []encodeFunc(nil)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			encode, err := encoderOf(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", f.Name, err)
+			}
+			fields = append(fields, i)
+			encodes = append(encodes, encode)
+		}
+		return func(e *encoder, v reflect.Value) {
+			for n, i := range fields {
+				encodes[n](e, v.Field(i))
+			}
+		}, nil
+	}
+	return nil, unsupported(t)
+}
+
+func decoderOf(t reflect.Type) (decodeFunc, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(d *decoder, v reflect.Value) {
+			b := d.bytes(1)
+			if b != nil {
+				v.SetBool(b[0] != 0)
+			}
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(d *decoder, v reflect.Value) {
+			i, n := binary.Varint(d.buf)
+			if n <= 0 {
+				d.fail(errShort)
+				return
+			}
+			d.buf = d.buf[n:]
+			v.SetInt(i)
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(d *decoder, v reflect.Value) {
+			v.SetUint(d.uint())
+		}, nil
+	case reflect.Float32:
+		return func(d *decoder, v reflect.Value) {
+			b := d.bytes(4)
+			if b != nil {
+				v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+			}
+		}, nil
+	case reflect.Float64:
+		return func(d *decoder, v reflect.Value) {
+			b := d.bytes(8)
+			if b != nil {
+				v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			}
+		}, nil
+	case reflect.String:
+		return func(d *decoder, v reflect.Value) {
+			v.SetString(string(d.bytes(d.len())))
+		}, nil
+	case reflect.Array:
+		decodeElem, err := decoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decoder, v reflect.Value) {
+			for i := 0; i < v.Len() && d.err == nil; i++ {
+				decodeElem(d, v.Index(i))
+			}
+		}, nil
+	case reflect.Slice:
+		decodeElem, err := decoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decoder, v reflect.Value) {
+			n := d.lenNil()
+			if n < 0 {
+				return
+			}
+			s := reflect.MakeSlice(t, n, n)
+			for i := 0; i < n && d.err == nil; i++ {
+				decodeElem(d, s.Index(i))
+			}
+			v.Set(s)
+		}, nil
+	case reflect.Map:
+		decodeKey, err := decoderOf(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		decodeElem, err := decoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decoder, v reflect.Value) {
+			n := d.lenNil()
+			if n < 0 {
+				return
+			}
+			m := reflect.MakeMapWithSize(t, n)
+			key := reflect.New(t.Key()).Elem()
+			elem := reflect.New(t.Elem()).Elem()
+			for i := 0; i < n && d.err == nil; i++ {
+				key.SetZero()
+				elem.SetZero()
+				decodeKey(d, key)
+				decodeElem(d, elem)
+				m.SetMapIndex(key, elem)
+			}
+			v.Set(m)
+		}, nil
+	case reflect.Struct:
+		fields, decodes := []int(nil), []decodeFunc(nil)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			decode, err := decoderOf(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", f.Name, err)
+			}
+			fields = append(fields, i)
+			decodes = append(decodes, decode)
+		}
+		return func(d *decoder, v reflect.Value) {
+			for n, i := range fields {
+				if d.err != nil {
+					return
+				}
+				decodes[n](d, v.Field(i))
+			}
+		}, nil
+	}
+	return nil, unsupported(t)
+}
@@ -2,15 +2,22 @@ package recordfile_test
 
 import (
 	"fmt"
+	"github.com/xuri/excelize/v2"
+	"github.com/zfiona/server-base/chanrpc"
 	"github.com/zfiona/server-base/recordfile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func Example() {
 	type Record struct {
 		// index 0
-		IndexInt int `json:"index"`
+		IndexInt int `rf:"index"`
 		// index 1
-		IndexStr string `json:"index2"`
+		IndexStr string `rf:"index"`
 		_Number  int32
 		Str      string
 		Arr1     [2]int
@@ -65,3 +72,401 @@ func Example() {
 	// name5566
 	// 6
 }
+
+func ExampleGet() {
+	type Item struct {
+		ID   int    `rf:"index=byID"`
+		Name string `rf:"index=byName"`
+		Type string `rf:"multi=byType,index=byTypeLevel"`
+		Lv   int    `rf:"index=byTypeLevel"`
+	}
+
+	rf, err := recordfile.New(Item{})
+	if err != nil {
+		return
+	}
+
+	err = rf.Read("item.txt")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	item, ok := recordfile.Get[int, *Item](rf, "byID", 1002)
+	fmt.Println(item.Name, ok)
+
+	item, ok = recordfile.Get[string, *Item](rf, "byName", "shield")
+	fmt.Println(item.ID, ok)
+
+	// composite index
+	item, ok = recordfile.Get[[2]interface{}, *Item](rf, "byTypeLevel", [2]interface{}{"weapon", 2})
+	fmt.Println(item.Name, ok)
+
+	// multi index
+	for _, item := range recordfile.GetAll[string, *Item](rf, "byType", "weapon") {
+		fmt.Println(item.Name)
+	}
+
+	_, ok = recordfile.Get[int, *Item](rf, "byID", 9999)
+	fmt.Println(ok)
+
+	// Output:
+	// axe true
+	// 2001 true
+	// axe true
+	// sword
+	// axe
+	// false
+}
+
+func ExampleManager() {
+	type Item struct {
+		ID    int `rf:"index"`
+		Price int
+	}
+
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	write := func(data string, modTime time.Time) {
+		name := filepath.Join(dir, "item.txt")
+		ioutil.WriteFile(name, []byte("ID\tPrice\n"+data), 0644)
+		os.Chtimes(name, modTime, modTime)
+	}
+	write("1\t100\n", time.Unix(1, 0))
+
+	m := recordfile.NewManager(dir)
+	err = m.Register("item.txt", Item{}, func(rf *recordfile.RecordFile) error {
+		for _, item := range recordfile.Records[*Item](rf) {
+			if item.Price <= 0 {
+				return fmt.Errorf("item %v: invalid price", item.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// a module
+	s := chanrpc.NewServer(10)
+	s.Register("TableReloaded", func(args []interface{}) {
+		name := args[0].(string)
+		rf := args[1].(*recordfile.RecordFile)
+		item, _ := recordfile.Get[int, *Item](rf, "ID", 1)
+		fmt.Println(name, "reloaded, price", item.Price)
+	})
+	m.Subscribe(s, "TableReloaded")
+
+	write("1\t200\n", time.Unix(2, 0))
+	m.Reload()
+	s.Exec(<-s.ChanCall)
+
+	write("1\t-1\n", time.Unix(3, 0))
+	fmt.Println(m.Reload())
+	item, _ := recordfile.Get[int, *Item](m.Get("item.txt"), "ID", 1)
+	fmt.Println("price", item.Price)
+
+	// Output:
+	// item.txt reloaded, price 200
+	// table item.txt: item 1: invalid price
+	// price 200
+}
+
+func ExampleRecordFile_Read() {
+	type Item struct {
+		ID    int `rf:"index"`
+		Name  string
+		Attrs map[string]int
+	}
+
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "item.json"), []byte(`[
+		{"ID": 1, "Name": "sword", "Attrs": {"atk": 10}}
+	]`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "item.yaml"), []byte(`
+- ID: 2
+  Name: shield
+  Attrs: {def: 8}
+`), 0644)
+
+	// columns in any order, mapped by the header
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Name", "Attrs", "ID"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{"bow", `{"atk": 7}`, 3})
+	f.SaveAs(filepath.Join(dir, "item.xlsx"))
+	f.Close()
+
+	for _, name := range []string{"item.json", "item.yaml", "item.xlsx"} {
+		rf, err := recordfile.New(Item{})
+		if err != nil {
+			return
+		}
+		err = rf.Read(filepath.Join(dir, name))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		item := rf.Record(0).(*Item)
+		fmt.Println(name, item.ID, item.Name, item.Attrs)
+	}
+
+	// Output:
+	// item.json 1 sword map[atk:10]
+	// item.yaml 2 shield map[def:8]
+	// item.xlsx 3 bow map[atk:7]
+}
+
+func ExampleRecordFile_Read_schema() {
+	type Monster struct {
+		ID    int    `rf:"index,min=1"`
+		Name  string `rf:"name=MonsterName,required,regex=^[a-z]+$"`
+		Kind  string `rf:"enum=beast|undead"`
+		Lv    int    `rf:"default=1,max=99"`
+		Drops []int  `rf:"optional,max=3"`
+		Power int    `rf:"-"`
+	}
+
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "monster.txt")
+
+	rf, err := recordfile.New(Monster{})
+	if err != nil {
+		return
+	}
+
+	// columns in any order, Comment ignored, Lv and Drops missing
+	ioutil.WriteFile(name, []byte(
+		"Kind\tComment\tMonsterName\tID\n"+
+			"beast\tthe first\twolf\t1\n"+
+			"undead\t\tghoul\t2\n"), 0644)
+	err = rf.Read(name)
+	if err != nil {
+		return
+	}
+	for _, m := range recordfile.Records[*Monster](rf) {
+		fmt.Println(m.ID, m.Name, m.Kind, m.Lv, m.Drops)
+	}
+
+	// every violation is reported with its row in the file
+	ioutil.WriteFile(name, []byte(
+		"ID\tMonsterName\tKind\tLv\tDrops\n"+
+			"# beasts\n"+
+			"0\tWolf\tbeast\t\t[1]\n"+
+			"2\t\tdragon\t100\t[1, 2, 3, 4]\n"+
+			"\n"+
+			"3\tbat\tbeast\tx\t\n"), 0644)
+	err = rf.Read(name)
+	fmt.Println(strings.ReplaceAll(err.Error(), dir, "dir"))
+
+	name = filepath.Join(dir, "monster.yaml")
+	ioutil.WriteFile(name, []byte(`
+# beasts
+- {ID: 1, MonsterName: wolf, Kind: beast}
+- ID: 2
+  MonsterName: bat
+  Kind: bird
+`), 0644)
+	err = rf.Read(name)
+	fmt.Println(strings.ReplaceAll(err.Error(), dir, "dir"))
+
+	name = filepath.Join(dir, "monster.json")
+	ioutil.WriteFile(name, []byte(`[
+  {"ID": 1, "MonsterName": "wolf", "Kind": "beast"},
+
+  {"ID": 1, "MonsterName": "bat", "Kind": "beast"}
+]`), 0644)
+	err = rf.Read(name)
+	fmt.Println(strings.ReplaceAll(err.Error(), dir, "dir"))
+
+	// an empty number is missing, not invalid
+	type Boss struct {
+		ID int `rf:"index"`
+		HP int `rf:"required,min=1"`
+	}
+	rf, err = recordfile.New(Boss{})
+	if err != nil {
+		return
+	}
+	name = filepath.Join(dir, "boss.txt")
+	ioutil.WriteFile(name, []byte(
+		"ID\tHP\n"+
+			"1\t100\n"+
+			"2\t\n"), 0644)
+	err = rf.Read(name)
+	fmt.Println(strings.ReplaceAll(err.Error(), dir, "dir"))
+
+	// Output:
+	// 1 wolf beast 1 []
+	// 2 ghoul undead 1 []
+	// dir/monster.txt (row=3, col=ID): 0 < min 1
+	// dir/monster.txt (row=3, col=MonsterName): "Wolf" does not match ^[a-z]+$
+	// dir/monster.txt (row=4, col=MonsterName): required
+	// dir/monster.txt (row=4, col=Kind): "dragon" not in beast|undead
+	// dir/monster.txt (row=4, col=Lv): 100 > max 99
+	// dir/monster.txt (row=4, col=Drops): length 4 > max 3
+	// dir/monster.txt (row=6, col=Lv): strconv.ParseInt: parsing "x": invalid syntax
+	// dir/monster.yaml (row=4, col=Kind): "bird" not in beast|undead
+	// dir/monster.json: index ID error: duplicate 1 at (row=4)
+	// dir/boss.txt (row=3, col=HP): required
+}
+
+func ExampleManager_Validate() {
+	type Drop struct {
+		ID    int `rf:"index"`
+		Items []int
+	}
+	type Item struct {
+		ID          int `rf:"index"`
+		DropTableID int `rf:"ref=drop.txt:ID"`
+	}
+
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string, modTime time.Time) {
+		name = filepath.Join(dir, name)
+		ioutil.WriteFile(name, []byte(data), 0644)
+		os.Chtimes(name, modTime, modTime)
+	}
+	write("drop.txt", "ID\tItems\n10\t[1, 2]\n", time.Unix(1, 0))
+	write("item.txt", "ID\tDropTableID\n1\t10\n2\t0\n3\t11\n", time.Unix(1, 0))
+
+	m := recordfile.NewManager(dir)
+	m.Register("drop.txt", Drop{}, nil)
+	m.Register("item.txt", Item{}, nil)
+	fmt.Println(m.Validate())
+
+	// fixed together with drop.txt
+	write("drop.txt", "ID\tItems\n10\t[1, 2]\n11\t[3]\n", time.Unix(2, 0))
+	fmt.Println(m.Reload())
+
+	// the new item.txt is pending until its references are fixed
+	write("item.txt", "ID\tDropTableID\n1\t10\n2\t12\n", time.Unix(3, 0))
+	fmt.Println(m.Reload())
+	fmt.Println(m.Get("item.txt").NumRecord())
+
+	write("drop.txt", "ID\tItems\n10\t[1, 2]\n12\t[3]\n", time.Unix(4, 0))
+	fmt.Println(m.Reload())
+	fmt.Println(m.Get("item.txt").NumRecord())
+
+	// Output:
+	// item.txt (row=4, col=DropTableID): 11 not found in drop.txt:ID
+	// <nil>
+	// item.txt (row=3, col=DropTableID): 12 not found in drop.txt:ID
+	// 3
+	// <nil>
+	// 2
+}
+
+func ExampleRecordFile_ReadWithSnapshot() {
+	type Item struct {
+		ID   int `rf:"index"`
+		Name string
+		Type string
+		Lv   int
+	}
+
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "item.snap")
+
+	// compiled at build time
+	rf, err := recordfile.New(Item{})
+	if err != nil {
+		return
+	}
+	err = rf.Read("item.txt")
+	if err != nil {
+		return
+	}
+	err = rf.WriteSnapshot(snapshot)
+	if err != nil {
+		return
+	}
+
+	// loaded at run time
+	rf, _ = recordfile.New(Item{})
+	err = rf.ReadSnapshot(snapshot)
+	if err != nil {
+		return
+	}
+	item, _ := recordfile.Get[int, *Item](rf, "ID", 1002)
+	fmt.Println(rf.NumRecord(), item.Name)
+
+	// the record type changed
+	type ItemV2 struct {
+		ID    int `rf:"index"`
+		Name  string
+		Type  string
+		Lv    int
+		Price int `rf:"optional"`
+	}
+	rf, _ = recordfile.New(ItemV2{})
+	fmt.Println(rf.ReadSnapshot(snapshot))
+	err = rf.ReadWithSnapshot("item.txt", snapshot)
+	fmt.Println(rf.NumRecord(), err)
+
+	// Output:
+	// 3 axe
+	// snapshot schema mismatch
+	// 3 <nil>
+}
+
+func ExampleRecordFile_WriteSnapshot() {
+	type Quest struct {
+		ID     int `rf:"index"`
+		Params map[string]interface{}
+	}
+
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "quest.yaml")
+	snapshot := filepath.Join(dir, "quest.snap")
+	ioutil.WriteFile(source, []byte("- {ID: 1, Params: {kill: wolf, count: 3}}\n"), 0644)
+
+	rf, err := recordfile.New(Quest{})
+	if err != nil {
+		return
+	}
+	err = rf.Read(source)
+	if err != nil {
+		return
+	}
+
+	// interface values are not supported by snapshots
+	err = rf.WriteSnapshot(snapshot)
+	fmt.Println(strings.ReplaceAll(err.Error(), dir, "dir"))
+	_, err = os.Stat(snapshot)
+	fmt.Println(os.IsNotExist(err))
+
+	// the source is read
+	rf, _ = recordfile.New(Quest{})
+	err = rf.ReadWithSnapshot(source, snapshot)
+	quest, _ := recordfile.Get[int, *Quest](rf, "ID", 1)
+	fmt.Println(quest.Params["kill"], quest.Params["count"], err)
+
+	// Output:
+	// dir/quest.snap: Params: unsupported type interface {}
+	// true
+	// wolf 3 <nil>
+}
@@ -0,0 +1,97 @@
+package gen_test
+
+import (
+	"fmt"
+	"github.com/zfiona/server-base/recordfile/gen"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func Example() {
+	dir, err := ioutil.TempDir("", "table")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "item_base.txt")
+	ioutil.WriteFile(name, []byte(
+		"ID\tName\tType\tLv\tDrop list\tNote\n"+
+			"#int,index\tstring,index=byName\tstring,multi,index=byTypeLevel\tint,default=1,index=byTypeLevel\t[]int32,optional\t\n"+
+			"1001\tsword\tweapon\t1\t[1, 2]\tthe first one\n"), 0644)
+
+	t, err := gen.ReadTable(name, '\t')
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	src, err := gen.GoSource("data", []*gen.Table{t})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(string(src))
+	fmt.Println("----")
+	fmt.Print(string(gen.CSharpSource("Data", []*gen.Table{t})))
+
+	// Output:
+	// // Code generated by rfgen. DO NOT EDIT.
+	//
+	// package data
+	//
+	// import "github.com/zfiona/server-base/recordfile"
+	//
+	// // ItemBase a record of item_base.txt
+	// type ItemBase struct {
+	// 	ID       int     `rf:"index"`
+	// 	Name     string  `rf:"index=byName"`
+	// 	Type     string  `rf:"multi,index=byTypeLevel"`
+	// 	Lv       int     `rf:"default=1,index=byTypeLevel"`
+	// 	DropList []int32 `rf:"name=Drop list,optional"`
+	// }
+	//
+	// func NewItemBaseFile() (*recordfile.RecordFile, error) {
+	// 	return recordfile.New(ItemBase{})
+	// }
+	//
+	// func ItemBaseRecords(rf *recordfile.RecordFile) []*ItemBase {
+	// 	return recordfile.Records[*ItemBase](rf)
+	// }
+	//
+	// func GetItemBaseByID(rf *recordfile.RecordFile, id int) (*ItemBase, bool) {
+	// 	return recordfile.Get[int, *ItemBase](rf, "ID", id)
+	// }
+	//
+	// func GetItemBaseByName(rf *recordfile.RecordFile, name string) (*ItemBase, bool) {
+	// 	return recordfile.Get[string, *ItemBase](rf, "byName", name)
+	// }
+	//
+	// func GetAllItemBaseByType(rf *recordfile.RecordFile, typ string) []*ItemBase {
+	// 	return recordfile.GetAll[string, *ItemBase](rf, "Type", typ)
+	// }
+	//
+	// func GetItemBaseByTypeLevel(rf *recordfile.RecordFile, typ string, lv int) (*ItemBase, bool) {
+	// 	return recordfile.Get[[2]interface{}, *ItemBase](rf, "byTypeLevel", [2]interface{}{typ, lv})
+	// }
+	// ----
+	// // <auto-generated>
+	// // Code generated by rfgen. DO NOT EDIT.
+	// // </auto-generated>
+	//
+	// using System.Collections.Generic;
+	//
+	// namespace Data
+	// {
+	//     // a record of item_base.txt
+	//     public class ItemBase
+	//     {
+	//         public long ID;
+	//         public string Name;
+	//         public string Type;
+	//         public long Lv;
+	//         public List<int> DropList;
+	//     }
+	// }
+}
@@ -0,0 +1,424 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"github.com/zfiona/server-base/recordfile"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Table the record type of a table file. The first row of the file is the
+// header, the second one the type row: a comment row (starting with
+// recordfile.Comment) with the Go type of each column, followed by the
+// options of its rf tag:
+//
+//	ID            Name             Type            Lv
+//	#int,index    string,required  string,multi    int,default=1
+//
+// A column with an empty type is not generated
+type Table struct {
+	// the Go type, after the file name: drop_table.txt is DropTable
+	Name   string
+	File   string
+	Fields []Field
+}
+
+type Field struct {
+	Name   string
+	Column string
+	Type   string
+	// the rf tag
+	Tag string
+}
+
+// ReadTable the header and the type row of a .xlsx file, the first sheet, or
+// of a text file with fields separated by comma
+func ReadTable(name string, comma rune) (*Table, error) {
+	var rows [][]string
+	var err error
+	if strings.ToLower(filepath.Ext(name)) == ".xlsx" {
+		rows, err = readXLSX(name)
+	} else {
+		rows, err = readText(name, comma)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("%v: missing header or type row", name)
+	}
+
+	header, types := rows[0], rows[1]
+	comment := string(recordfile.Comment)
+	if len(types) == 0 || !strings.HasPrefix(types[0], comment) {
+		return nil, fmt.Errorf("%v: the type row must start with %v", name, comment)
+	}
+	types[0] = strings.TrimPrefix(types[0], comment)
+
+	t := new(Table)
+	t.Name = exported(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)))
+	t.File = filepath.Base(name)
+	names := make(map[string]string)
+	for c, column := range header {
+		column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		if c >= len(types) || column == "" || strings.TrimSpace(types[c]) == "" {
+			continue
+		}
+
+		f := Field{Column: column, Name: exported(column)}
+		typ := strings.TrimSpace(types[c])
+		if i := strings.IndexByte(typ, ','); i >= 0 {
+			typ, f.Tag = strings.TrimSpace(typ[:i]), strings.TrimSpace(typ[i+1:])
+		}
+		f.Type = typ
+		if f.Name != column {
+			if f.Tag == "" {
+				f.Tag = "name=" + column
+			} else {
+				f.Tag = "name=" + column + "," + f.Tag
+			}
+		}
+		if other, ok := names[f.Name]; ok {
+			return nil, fmt.Errorf("%v: columns %v and %v are both field %v",
+				name, other, column, f.Name)
+		}
+		names[f.Name] = column
+		t.Fields = append(t.Fields, f)
+	}
+
+	// the same checks as at run time
+	st, err := t.structOf()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	_, err = recordfile.New(reflect.New(st).Elem().Interface())
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	return t, nil
+}
+
+func readText(name string, comma rune) ([][]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	var rows [][]string
+	for len(rows) < 2 {
+		row, err := reader.Read()
+		if err != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readXLSX(name string) ([][]string, error) {
+	f, err := excelize.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+	var lines [][]string
+	for _, row := range rows {
+		if len(row) > 0 {
+			lines = append(lines, row)
+		}
+	}
+	return lines, nil
+}
+
+// exported the Go name of s: item_drop is ItemDrop
+func exported(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('F')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var basicTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"int":     reflect.TypeOf(int(0)),
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"string":  reflect.TypeOf(""),
+}
+
+// typeOf the type of a basic type, or an array, a slice or a map of them
+func typeOf(expr ast.Expr) (reflect.Type, error) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if t, ok := basicTypes[expr.Name]; ok {
+			return t, nil
+		}
+	case *ast.ArrayType:
+		elem, err := typeOf(expr.Elt)
+		if err != nil {
+			return nil, err
+		}
+		if expr.Len == nil {
+			return reflect.SliceOf(elem), nil
+		}
+		if lit, ok := expr.Len.(*ast.BasicLit); ok && lit.Kind == token.INT {
+			n, err := strconv.Atoi(lit.Value)
+			if err == nil {
+				return reflect.ArrayOf(n, elem), nil
+			}
+		}
+	case *ast.MapType:
+		key, err := typeOf(expr.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := typeOf(expr.Value)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, value), nil
+	}
+	return nil, errors.New("unsupported type")
+}
+
+func (t *Table) structOf() (reflect.Type, error) {
+	fields := make([]reflect.StructField, len(t.Fields))
+	for i, f := range t.Fields {
+		expr, err := parser.ParseExpr(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: invalid type %v", f.Column, f.Type)
+		}
+		typ, err := typeOf(expr)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v %v", f.Column, err, f.Type)
+		}
+		fields[i] = reflect.StructField{Name: f.Name, Type: typ}
+		if f.Tag != "" {
+			fields[i].Tag = reflect.StructTag(`rf:` + strconv.Quote(f.Tag))
+		}
+	}
+	return reflect.StructOf(fields), nil
+}
+
+type index struct {
+	name   string
+	multi  bool
+	fields []Field
+}
+
+// indexes declared by the rf tags, in order of declaration
+func (t *Table) indexes() []*index {
+	var indexes []*index
+	byName := make(map[string]*index)
+	for _, f := range t.Fields {
+		for _, opt := range strings.Split(f.Tag, ",") {
+			if strings.HasPrefix(opt, "regex=") {
+				break
+			}
+			key, name := opt, ""
+			if j := strings.IndexByte(opt, '='); j >= 0 {
+				key, name = opt[:j], opt[j+1:]
+			}
+			if key != "index" && key != "multi" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			i, ok := byName[name]
+			if !ok {
+				i = &index{name: name, multi: key == "multi"}
+				byName[name] = i
+				indexes = append(indexes, i)
+			}
+			i.fields = append(i.fields, f)
+		}
+	}
+	return indexes
+}
+
+// GoSource the record types of the tables, their indexes and typed accessors:
+//
+//	func NewItemFile() (*recordfile.RecordFile, error)
+//	func ItemRecords(rf *recordfile.RecordFile) []*Item
+//	func GetItemByID(rf *recordfile.RecordFile, id int) (*Item, bool)
+//	func GetAllItemByType(rf *recordfile.RecordFile, typ string) []*Item
+func GoSource(pkg string, tables []*Table) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by rfgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %v\n\n", pkg)
+	fmt.Fprintf(&b, "import \"github.com/zfiona/server-base/recordfile\"\n")
+
+	for _, t := range tables {
+		fmt.Fprintf(&b, "\n// %v a record of %v\n", t.Name, t.File)
+		fmt.Fprintf(&b, "type %v struct {\n", t.Name)
+		for _, f := range t.Fields {
+			if f.Tag == "" {
+				fmt.Fprintf(&b, "%v %v\n", f.Name, f.Type)
+			} else {
+				fmt.Fprintf(&b, "%v %v `rf:%v`\n", f.Name, f.Type, strconv.Quote(f.Tag))
+			}
+		}
+		fmt.Fprintf(&b, "}\n")
+
+		fmt.Fprintf(&b, "\nfunc New%vFile() (*recordfile.RecordFile, error) {\n", t.Name)
+		fmt.Fprintf(&b, "return recordfile.New(%v{})\n}\n", t.Name)
+
+		fmt.Fprintf(&b, "\nfunc %vRecords(rf *recordfile.RecordFile) []*%v {\n", t.Name, t.Name)
+		fmt.Fprintf(&b, "return recordfile.Records[*%v](rf)\n}\n", t.Name)
+
+		for _, i := range t.indexes() {
+			writeAccessor(&b, t, i)
+		}
+	}
+
+	return format.Source(b.Bytes())
+}
+
+func writeAccessor(b *bytes.Buffer, t *Table, i *index) {
+	name := i.name
+	if strings.HasPrefix(name, "by") && len(name) > 2 && unicode.IsUpper(rune(name[2])) {
+		name = name[2:]
+	}
+	name = exported(name)
+
+	params := make([]string, len(i.fields))
+	args := make([]string, len(i.fields))
+	for n, f := range i.fields {
+		args[n] = param(f.Name)
+		params[n] = args[n] + " " + f.Type
+	}
+	keyType, key := i.fields[0].Type, args[0]
+	if len(i.fields) > 1 {
+		keyType = fmt.Sprintf("[%v]interface{}", len(i.fields))
+		key = keyType + "{" + strings.Join(args, ", ") + "}"
+	}
+
+	if i.multi {
+		fmt.Fprintf(b, "\nfunc GetAll%vBy%v(rf *recordfile.RecordFile, %v) []*%v {\n",
+			t.Name, name, strings.Join(params, ", "), t.Name)
+		fmt.Fprintf(b, "return recordfile.GetAll[%v, *%v](rf, %q, %v)\n}\n",
+			keyType, t.Name, i.name, key)
+	} else {
+		fmt.Fprintf(b, "\nfunc Get%vBy%v(rf *recordfile.RecordFile, %v) (*%v, bool) {\n",
+			t.Name, name, strings.Join(params, ", "), t.Name)
+		fmt.Fprintf(b, "return recordfile.Get[%v, *%v](rf, %q, %v)\n}\n",
+			keyType, t.Name, i.name, key)
+	}
+}
+
+// param the parameter name of a field: ID is id, Type is typ
+func param(name string) string {
+	runes := []rune(name)
+	n := 1
+	for n < len(runes) && unicode.IsUpper(runes[n]) &&
+		(n+1 == len(runes) || unicode.IsUpper(runes[n+1])) {
+		n++
+	}
+	s := strings.ToLower(string(runes[:n])) + string(runes[n:])
+	if token.IsKeyword(s) || s == "rf" {
+		s = s[:len(s)-1]
+		if token.IsKeyword(s) || s == "" {
+			s = "key"
+		}
+	}
+	return s
+}
+
+var csharpTypes = map[string]string{
+	"bool":    "bool",
+	"int":     "long",
+	"int8":    "sbyte",
+	"int16":   "short",
+	"int32":   "int",
+	"int64":   "long",
+	"uint":    "ulong",
+	"uint8":   "byte",
+	"uint16":  "ushort",
+	"uint32":  "uint",
+	"uint64":  "ulong",
+	"float32": "float",
+	"float64": "double",
+	"string":  "string",
+}
+
+func csharpType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return csharpTypes[expr.Name]
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return "List<" + csharpType(expr.Elt) + ">"
+		}
+		return csharpType(expr.Elt) + "[]"
+	case *ast.MapType:
+		return "Dictionary<" + csharpType(expr.Key) + ", " + csharpType(expr.Value) + ">"
+	}
+	return ""
+}
+
+// CSharpSource the record classes of the tables, with the same fields as
+// the Go types. Go int and uint are 64 bits, long and ulong in C#
+func CSharpSource(namespace string, tables []*Table) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// <auto-generated>\n// Code generated by rfgen. DO NOT EDIT.\n// </auto-generated>\n\n")
+	fmt.Fprintf(&b, "using System.Collections.Generic;\n\n")
+	fmt.Fprintf(&b, "namespace %v\n{\n", namespace)
+	for n, t := range tables {
+		if n > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "    // a record of %v\n", t.File)
+		fmt.Fprintf(&b, "    public class %v\n    {\n", t.Name)
+		for _, f := range t.Fields {
+			expr, _ := parser.ParseExpr(f.Type)
+			fmt.Fprintf(&b, "        public %v %v;\n", csharpType(expr), f.Name)
+		}
+		fmt.Fprintf(&b, "    }\n")
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.Bytes()
+}
@@ -0,0 +1,259 @@
+package recordfile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zfiona/server-base/chanrpc"
+	"github.com/zfiona/server-base/log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Manager the tables of a data directory, reloaded when their files change.
+// A reloaded table replaces the current one only if it is read and
+// validated successfully, readers get either version as a whole.
+// The fields tagged rf:"ref=table:index" reference the tables of the
+// Manager, a new version of a table is kept pending while its references, or
+// the references to it, are broken
+type Manager struct {
+	// how often files are checked, default 2 seconds
+	Interval time.Duration
+
+	dir         string
+	mutexReload sync.Mutex
+	mutex       sync.Mutex
+	tables      map[string]*table
+	subscribers []subscriber
+	closeSig    chan struct{}
+	wg          sync.WaitGroup
+}
+
+type table struct {
+	name     string
+	st       interface{}
+	validate func(rf *RecordFile) error
+	rf       atomic.Pointer[RecordFile]
+	pending  *RecordFile
+	modTime  time.Time
+	size     int64
+}
+
+type subscriber struct {
+	server *chanrpc.Server
+	id     interface{}
+}
+
+func NewManager(dir string) *Manager {
+	m := new(Manager)
+	m.Interval = 2 * time.Second
+	m.dir = dir
+	m.tables = make(map[string]*table)
+	return m
+}
+
+// Register goroutine safe
+// reads the table of the file name in the directory, st is the record type
+// as in New and validate, if any, checks each version of the table
+func (m *Manager) Register(name string, st interface{}, validate func(rf *RecordFile) error) error {
+	t := &table{name: name, st: st, validate: validate}
+	rf, modTime, size, err := m.load(t)
+	if err != nil {
+		return err
+	}
+	t.rf.Store(rf)
+	t.modTime = modTime
+	t.size = size
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.tables[name]; ok {
+		return fmt.Errorf("table %v: already registered", name)
+	}
+	m.tables[name] = t
+	return nil
+}
+
+// Get goroutine safe
+// the current version of the table, nil if not registered
+func (m *Manager) Get(name string) *RecordFile {
+	m.mutex.Lock()
+	t := m.tables[name]
+	m.mutex.Unlock()
+
+	if t == nil {
+		return nil
+	}
+	return t.rf.Load()
+}
+
+// Validate goroutine safe
+// checks the references between the tables, to call once all the tables are
+// registered
+func (m *Manager) Validate() error {
+	m.mutexReload.Lock()
+	defer m.mutexReload.Unlock()
+
+	m.mutex.Lock()
+	set := make(map[string]*RecordFile, len(m.tables))
+	for name, t := range m.tables {
+		set[name] = t.rf.Load()
+	}
+	m.mutex.Unlock()
+
+	return errors.Join(checkRefs(set)...)
+}
+
+// Subscribe goroutine safe
+// the function id of server is called with the name and the new version of
+// each reloaded table: func(args []interface{}) with args[0].(string) and
+// args[1].(*RecordFile)
+func (m *Manager) Subscribe(server *chanrpc.Server, id interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.subscribers = append(m.subscribers, subscriber{server, id})
+}
+
+func (m *Manager) load(t *table) (*RecordFile, time.Time, int64, error) {
+	filename := filepath.Join(m.dir, t.name)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, time.Time{}, 0, err
+	}
+
+	rf, err := New(t.st)
+	if err != nil {
+		return nil, time.Time{}, 0, err
+	}
+	err = rf.Read(filename)
+	if err != nil {
+		return nil, time.Time{}, 0, fmt.Errorf("table %v: %v", t.name, err)
+	}
+	if t.validate != nil {
+		err = t.validate(rf)
+		if err != nil {
+			return nil, time.Time{}, 0, fmt.Errorf("table %v: %v", t.name, err)
+		}
+	}
+	return rf, info.ModTime(), info.Size(), nil
+}
+
+// Reload goroutine safe
+// reloads the tables whose files changed and notifies the subscribers,
+// the errors of the tables kept at their old version are returned
+func (m *Manager) Reload() error {
+	m.mutexReload.Lock()
+	defer m.mutexReload.Unlock()
+
+	m.mutex.Lock()
+	tables := make([]*table, 0, len(m.tables))
+	for _, t := range m.tables {
+		tables = append(tables, t)
+	}
+	subscribers := m.subscribers
+	m.mutex.Unlock()
+
+	var errs []error
+	changed := false
+	for _, t := range tables {
+		info, err := os.Stat(filepath.Join(m.dir, t.name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+			continue
+		}
+
+		// not retried until the file changes again
+		changed = true
+		t.modTime = info.ModTime()
+		t.size = info.Size()
+		rf, _, _, err := m.load(t)
+		if err != nil {
+			t.pending = nil
+			errs = append(errs, err)
+			continue
+		}
+		t.pending = rf
+	}
+	if !changed {
+		return errors.Join(errs...)
+	}
+
+	// the references of the new versions with the others
+	set := make(map[string]*RecordFile, len(tables))
+	for _, t := range tables {
+		if t.pending != nil {
+			set[t.name] = t.pending
+		} else {
+			set[t.name] = t.rf.Load()
+		}
+	}
+	refErrs := checkRefs(set)
+	if len(refErrs) > 0 {
+		return errors.Join(append(errs, refErrs...)...)
+	}
+
+	for _, t := range tables {
+		rf := t.pending
+		if rf == nil {
+			continue
+		}
+		t.pending = nil
+		t.rf.Store(rf)
+		log.Release("table %v reloaded", t.name)
+
+		for _, s := range subscribers {
+			s.server.Go(s.id, t.name, rf)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch checks the files every Interval until Close
+func (m *Manager) Watch() {
+	m.mutex.Lock()
+	if m.closeSig != nil {
+		m.mutex.Unlock()
+		return
+	}
+	m.closeSig = make(chan struct{})
+	closeSig := m.closeSig
+	m.mutex.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := m.Reload()
+				if err != nil {
+					log.Error("%v, old version kept", err)
+				}
+			case <-closeSig:
+				return
+			}
+		}
+	}()
+}
+
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	closeSig := m.closeSig
+	m.closeSig = nil
+	m.mutex.Unlock()
+
+	if closeSig != nil {
+		close(closeSig)
+		m.wg.Wait()
+	}
+}
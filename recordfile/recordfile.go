@@ -1,26 +1,114 @@
 package recordfile
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 var Comma = '\t'
 var Comment = '#'
 
+// Index of a unique index: key -> record, of a multi index: key -> []interface{}
 type Index map[interface{}]interface{}
 
 type RecordFile struct {
-	Comma      rune
-	Comment    rune
-	typeRecord reflect.Type
-	records    []interface{}
-	indexes    []Index
+	Comma   rune
+	Comment rune
+	// the sheet of a .xlsx file, the first one if empty
+	Sheet         string
+	typeRecord    reflect.Type
+	records       []interface{}
+	rowNums       []int // the row of each record in its file
+	indexes       []Index
+	indexDefs     []*indexDef
+	fieldDefs     []fieldDef
+	indexesByName map[string]Index
+}
+
+// indexDef declared by the tags of the fields:
+//
+//	`index`, `rf:"index"`    unique index named after the field
+//	`rf:"index=byName"`     unique index byName
+//	`rf:"multi=byType"`     non-unique index byType
+//
+// the fields of the same index make a composite key, [n]interface{} with
+// the values in field order
+type indexDef struct {
+	name    string
+	fields  []int
+	multi   bool
+	typeKey reflect.Type
+}
+
+func parseIndexTags(typeRecord reflect.Type) ([]*indexDef, error) {
+	var defs []*indexDef
+	byName := make(map[string]*indexDef)
+
+	for i := 0; i < typeRecord.NumField(); i++ {
+		f := typeRecord.Field(i)
+
+		var opts []string
+		if f.Tag == "index" {
+			opts = []string{"index"}
+		} else if tag, ok := f.Tag.Lookup("rf"); ok {
+			opts = splitTag(tag)
+		}
+
+		for _, opt := range opts {
+			key, name := opt, ""
+			if j := strings.IndexByte(opt, '='); j >= 0 {
+				key, name = opt[:j], opt[j+1:]
+			}
+			if key != "index" && key != "multi" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			switch f.Type.Kind() {
+			case reflect.Struct, reflect.Slice, reflect.Map:
+				return nil, fmt.Errorf("could not index %s field %v %v",
+					f.Type.Kind(), i, f.Name)
+			}
+			if f.PkgPath != "" {
+				return nil, fmt.Errorf("could not index unexported field %v %v",
+					i, f.Name)
+			}
+
+			def, ok := byName[name]
+			if !ok {
+				def = &indexDef{name: name, multi: key == "multi"}
+				byName[name] = def
+				defs = append(defs, def)
+			} else if def.multi != (key == "multi") {
+				return nil, fmt.Errorf("index %v: both unique and multi", name)
+			}
+			def.fields = append(def.fields, i)
+		}
+	}
+
+	for _, def := range defs {
+		if len(def.fields) > 1 {
+			def.typeKey = reflect.ArrayOf(len(def.fields), reflect.TypeOf((*interface{})(nil)).Elem())
+		}
+	}
+	return defs, nil
+}
+
+func (def *indexDef) key(record reflect.Value) interface{} {
+	if def.typeKey == nil {
+		return record.Field(def.fields[0]).Interface()
+	}
+	key := reflect.New(def.typeKey).Elem()
+	for i, n := range def.fields {
+		key.Index(i).Set(record.Field(n))
+	}
+	return key.Interface()
 }
 
 func New(st interface{}) (*RecordFile, error) {
@@ -56,150 +144,242 @@ func New(st interface{}) (*RecordFile, error) {
 			return nil, fmt.Errorf("invalid type: %v %s",
 				f.Name, kind)
 		}
+	}
 
-		tag := f.Tag
-		if tag == "index" {
-			switch kind {
-			case reflect.Struct, reflect.Slice, reflect.Map:
-				return nil, fmt.Errorf("could not index %s field %v %v",
-					kind, i, f.Name)
-			}
-		}
+	indexDefs, err := parseIndexTags(typeRecord)
+	if err != nil {
+		return nil, err
+	}
+	fieldDefs, err := parseFieldTags(typeRecord)
+	if err != nil {
+		return nil, err
 	}
 
 	rf := new(RecordFile)
 	rf.typeRecord = typeRecord
+	rf.indexDefs = indexDefs
+	rf.fieldDefs = fieldDefs
 
 	return rf, nil
 }
 
+// Read the format follows the extension of name: .xlsx, .json (array of
+// objects), .yaml or .yml (sequence of mappings), delimited text otherwise.
+// The first row of a table is its header: columns are mapped to fields by
+// name if the header names any field, by position otherwise. Every parse
+// error and tag violation is reported, with the row and the column
 func (rf *RecordFile) Read(name string) error {
-	file, err := os.Open(name)
+	t, err := rf.readRows(name)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	if rf.Comma == 0 {
-		rf.Comma = Comma
-	}
-	if rf.Comment == 0 {
-		rf.Comment = Comment
-	}
-	reader := csv.NewReader(file)
-	reader.Comma = rf.Comma
-	reader.Comment = rf.Comment
-	lines, err := reader.ReadAll()
-	if err != nil {
-		return err
+	lines := t.rows
+	if len(lines) == 0 {
+		return errors.New("missing header")
 	}
 
 	typeRecord := rf.typeRecord
 
-	// make records
-	records := make([]interface{}, len(lines)-1)
-
-	// make indexes
-	var indexes []Index
-	for i := 0; i < typeRecord.NumField(); i++ {
-		tag := typeRecord.Field(i).Tag
-		if tag == "index" {
-			indexes = append(indexes, make(Index))
+	// map columns
+	columns := rf.mapColumns(lines[0])
+	if columns == nil && t.byName {
+		columns = make([]int, typeRecord.NumField())
+		for i := range columns {
+			columns[i] = -1
+		}
+	}
+	if columns != nil && len(lines) > 1 {
+		var missing []string
+		for i, c := range columns {
+			def := &rf.fieldDefs[i]
+			if c < 0 && typeRecord.Field(i).PkgPath == "" && !def.ignore && !def.optional {
+				missing = append(missing, def.column)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%v: missing columns: %v", name, strings.Join(missing, ", "))
 		}
 	}
 
+	// make records
+	records := make([]interface{}, len(lines)-1)
+	rowNums := t.rowNums[1:]
+	var errs []error
+
 	for n := 1; n < len(lines); n++ {
 		value := reflect.New(typeRecord)
 		records[n-1] = value.Interface()
 		record := value.Elem()
 
 		line := lines[n]
-		if len(line) != typeRecord.NumField() {
-			return fmt.Errorf("line %v, field count mismatch: %v (file) %v (st)",
-				n, len(line), typeRecord.NumField())
+		row := rowNums[n-1]
+		if columns == nil && len(line) != typeRecord.NumField() {
+			errs = append(errs, fmt.Errorf("%v (row=%v): field count mismatch: %v (file) %v (st)",
+				name, row, len(line), typeRecord.NumField()))
+			continue
 		}
 
-		iIndex := 0
-
 		for i := 0; i < typeRecord.NumField(); i++ {
-			f := typeRecord.Field(i)
+			def := &rf.fieldDefs[i]
 
 			// records
-			strField := line[i]
 			field := record.Field(i)
-			if !field.CanSet() {
+			if !field.CanSet() || def.ignore {
 				continue
 			}
+			var strField string
+			if columns == nil {
+				strField = line[i]
+			} else if c := columns[i]; c >= 0 && c < len(line) {
+				strField = line[c]
+			}
+			if strField == "" && def.hasDefault {
+				strField = def.def
+			}
 
-			var err error
-
-			kind := f.Type.Kind()
-			if kind == reflect.Bool {
-				var v bool
-				v, err = strconv.ParseBool(strField)
-				if err == nil {
-					field.SetBool(v)
-				}
-			} else if kind == reflect.Int ||
-				kind == reflect.Int8 ||
-				kind == reflect.Int16 ||
-				kind == reflect.Int32 ||
-				kind == reflect.Int64 {
-				var v int64
-				v, err = strconv.ParseInt(strField, 0, f.Type.Bits())
-				if err == nil {
-					field.SetInt(v)
-				}
-			} else if kind == reflect.Uint ||
-				kind == reflect.Uint8 ||
-				kind == reflect.Uint16 ||
-				kind == reflect.Uint32 ||
-				kind == reflect.Uint64 {
-				var v uint64
-				v, err = strconv.ParseUint(strField, 0, f.Type.Bits())
-				if err == nil {
-					field.SetUint(v)
-				}
-			} else if kind == reflect.Float32 ||
-				kind == reflect.Float64 {
-				var v float64
-				v, err = strconv.ParseFloat(strField, f.Type.Bits())
-				if err == nil {
-					field.SetFloat(v)
-				}
-			} else if kind == reflect.String {
-				field.SetString(strField)
-			} else if kind == reflect.Struct ||
-				kind == reflect.Array ||
-				kind == reflect.Slice ||
-				kind == reflect.Map {
-				err = json.Unmarshal([]byte(strField), field.Addr().Interface())
-			}
-
-			if err != nil {
-				return fmt.Errorf("parse field (row=%v, col=%v) error: %v",
-					n, i, err)
-			}
-
-			// indexes
-			if f.Tag == "index" {
-				index := indexes[iIndex]
-				iIndex++
-				if _, ok := index[field.Interface()]; ok {
-					return fmt.Errorf("index error: duplicate at (row=%v, col=%v)",
-						n, i)
+			// before parsing, an empty number is a missing value
+			if strField == "" && def.required {
+				errs = append(errs, fmt.Errorf("%v (row=%v, col=%v): required",
+					name, row, def.column))
+				continue
+			}
+			if strField != "" || !def.optional {
+				err := setField(field, strField)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%v (row=%v, col=%v): %v",
+						name, row, def.column, err))
+					continue
 				}
-				index[field.Interface()] = records[n-1]
+			}
+
+			for _, v := range def.check(field, strField) {
+				errs = append(errs, fmt.Errorf("%v (row=%v, col=%v): %v",
+					name, row, def.column, v))
 			}
 		}
 	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// make indexes
+	indexes, indexesByName, err := rf.makeIndexes(records, rowNums)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
 
 	rf.records = records
+	rf.rowNums = rowNums
 	rf.indexes = indexes
+	rf.indexesByName = indexesByName
 
 	return nil
 }
 
+func setField(field reflect.Value, strField string) error {
+	var err error
+
+	kind := field.Kind()
+	if kind == reflect.Bool {
+		var v bool
+		v, err = strconv.ParseBool(strField)
+		if err == nil {
+			field.SetBool(v)
+		}
+	} else if kind == reflect.Int ||
+		kind == reflect.Int8 ||
+		kind == reflect.Int16 ||
+		kind == reflect.Int32 ||
+		kind == reflect.Int64 {
+		var v int64
+		v, err = strconv.ParseInt(strField, 0, field.Type().Bits())
+		if err == nil {
+			field.SetInt(v)
+		}
+	} else if kind == reflect.Uint ||
+		kind == reflect.Uint8 ||
+		kind == reflect.Uint16 ||
+		kind == reflect.Uint32 ||
+		kind == reflect.Uint64 {
+		var v uint64
+		v, err = strconv.ParseUint(strField, 0, field.Type().Bits())
+		if err == nil {
+			field.SetUint(v)
+		}
+	} else if kind == reflect.Float32 ||
+		kind == reflect.Float64 {
+		var v float64
+		v, err = strconv.ParseFloat(strField, field.Type().Bits())
+		if err == nil {
+			field.SetFloat(v)
+		}
+	} else if kind == reflect.String {
+		field.SetString(strField)
+	} else if kind == reflect.Struct ||
+		kind == reflect.Array ||
+		kind == reflect.Slice ||
+		kind == reflect.Map {
+		err = json.Unmarshal([]byte(strField), field.Addr().Interface())
+	}
+
+	return err
+}
+
+// mapColumns the column of each field, -1 if missing, nil if the header
+// names no field
+func (rf *RecordFile) mapColumns(header []string) []int {
+	byName := make(map[string]int, len(header))
+	for c, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		if _, ok := byName[h]; !ok {
+			byName[h] = c
+		}
+	}
+
+	typeRecord := rf.typeRecord
+	columns := make([]int, typeRecord.NumField())
+	found := false
+	for i := range columns {
+		def := &rf.fieldDefs[i]
+		c, ok := byName[def.column]
+		if !ok || def.ignore || typeRecord.Field(i).PkgPath != "" {
+			columns[i] = -1
+			continue
+		}
+		columns[i] = c
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return columns
+}
+
+// makeIndexes rowNums the row of each record in its file
+func (rf *RecordFile) makeIndexes(records []interface{}, rowNums []int) ([]Index, map[string]Index, error) {
+	indexes := make([]Index, len(rf.indexDefs))
+	indexesByName := make(map[string]Index, len(rf.indexDefs))
+	for i, def := range rf.indexDefs {
+		index := make(Index, len(records))
+		for n, r := range records {
+			key := def.key(reflect.ValueOf(r).Elem())
+			if def.multi {
+				rs, _ := index[key].([]interface{})
+				index[key] = append(rs, r)
+				continue
+			}
+			if _, ok := index[key]; ok {
+				return nil, nil, fmt.Errorf("index %v error: duplicate %v at (row=%v)",
+					def.name, key, rowNums[n])
+			}
+			index[key] = r
+		}
+		indexes[i] = index
+		indexesByName[def.name] = index
+	}
+	return indexes, indexesByName, nil
+}
+
 func (rf *RecordFile) Record(i int) interface{} {
 	return rf.records[i]
 }
@@ -208,6 +388,7 @@ func (rf *RecordFile) NumRecord() int {
 	return len(rf.records)
 }
 
+// Indexes in order of declaration
 func (rf *RecordFile) Indexes(i int) Index {
 	if i >= len(rf.indexes) {
 		return nil
@@ -222,3 +403,55 @@ func (rf *RecordFile) Index(i interface{}) interface{} {
 	}
 	return index[i]
 }
+
+// IndexByName nil if there is no such index
+func (rf *RecordFile) IndexByName(name string) Index {
+	return rf.indexesByName[name]
+}
+
+func (rf *RecordFile) mustIndex(name string, multi bool) Index {
+	for _, def := range rf.indexDefs {
+		if def.name == name {
+			if def.multi != multi {
+				if multi {
+					panic("unique index " + name + ", use Get")
+				}
+				panic("multi index " + name + ", use GetAll")
+			}
+			return rf.indexesByName[name]
+		}
+	}
+	panic("unknown index " + name)
+}
+
+// Get the record of key in the unique index, T is the pointer to the record
+// type, key is [n]interface{} for a composite index
+//
+//	r, ok := recordfile.Get[string, *Item](rf, "byName", "sword")
+func Get[K comparable, T any](rf *RecordFile, index string, key K) (T, bool) {
+	r, ok := rf.mustIndex(index, false)[key]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return r.(T), true
+}
+
+// GetAll the records of key in the multi index, in file order
+func GetAll[K comparable, T any](rf *RecordFile, index string, key K) []T {
+	rs, _ := rf.mustIndex(index, true)[key].([]interface{})
+	ts := make([]T, len(rs))
+	for i, r := range rs {
+		ts[i] = r.(T)
+	}
+	return ts
+}
+
+// Records all the records, in file order
+func Records[T any](rf *RecordFile) []T {
+	ts := make([]T, len(rf.records))
+	for i, r := range rf.records {
+		ts[i] = r.(T)
+	}
+	return ts
+}
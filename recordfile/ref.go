@@ -0,0 +1,111 @@
+package recordfile
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// checkRefs the references of the tables, declared by rf:"ref=table:index".
+// The zero value references nothing, each element of a slice or an array is
+// a reference
+func checkRefs(tables map[string]*RecordFile) []error {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		rf := tables[name]
+		for i := range rf.fieldDefs {
+			def := &rf.fieldDefs[i]
+			if def.refTable == "" {
+				continue
+			}
+
+			index, indexName, keyType, err := refIndex(tables, def)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v (col=%v): %v", name, def.column, err))
+				continue
+			}
+
+			for n, r := range rf.records {
+				field := reflect.ValueOf(r).Elem().Field(i)
+				keys, err := refKeys(field, keyType)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%v (col=%v): %v", name, def.column, err))
+					break
+				}
+				for _, key := range keys {
+					if _, ok := index[key]; !ok {
+						errs = append(errs, fmt.Errorf("%v (row=%v, col=%v): %v not found in %v:%v",
+							name, rf.rowNums[n], def.column, key, def.refTable, indexName))
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// refIndex the index referenced by def, its name and the type of its keys
+func refIndex(tables map[string]*RecordFile, def *fieldDef) (Index, string, reflect.Type, error) {
+	rf, ok := tables[def.refTable]
+	if !ok {
+		return nil, "", nil, fmt.Errorf("unknown table %v", def.refTable)
+	}
+	if len(rf.indexDefs) == 0 {
+		return nil, "", nil, fmt.Errorf("table %v has no index", def.refTable)
+	}
+
+	target := rf.indexDefs[0]
+	if def.refIndex != "" {
+		target = nil
+		for _, d := range rf.indexDefs {
+			if d.name == def.refIndex {
+				target = d
+				break
+			}
+		}
+		if target == nil {
+			return nil, "", nil, fmt.Errorf("unknown index %v:%v", def.refTable, def.refIndex)
+		}
+	}
+	if target.typeKey != nil {
+		return nil, "", nil, fmt.Errorf("composite index %v:%v", def.refTable, target.name)
+	}
+	return rf.indexesByName[target.name], target.name,
+		rf.typeRecord.Field(target.fields[0]).Type, nil
+}
+
+// refKeys the non-zero keys of field, converted to keyType
+func refKeys(field reflect.Value, keyType reflect.Type) ([]interface{}, error) {
+	var values []reflect.Value
+	if convertible(field.Type(), keyType) {
+		values = []reflect.Value{field}
+	} else if (field.Kind() == reflect.Slice || field.Kind() == reflect.Array) &&
+		convertible(field.Type().Elem(), keyType) {
+		for i := 0; i < field.Len(); i++ {
+			values = append(values, field.Index(i))
+		}
+	} else {
+		return nil, fmt.Errorf("%v could not reference keys of %v", field.Type(), keyType)
+	}
+
+	keys := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		if v.IsZero() {
+			continue
+		}
+		keys = append(keys, v.Convert(keyType).Interface())
+	}
+	return keys, nil
+}
+
+// convertible but not a number to a string
+func convertible(t, keyType reflect.Type) bool {
+	return t.ConvertibleTo(keyType) &&
+		(t.Kind() == reflect.String) == (keyType.Kind() == reflect.String)
+}
@@ -0,0 +1,186 @@
+package recordfile
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fieldDef declared by the rf tag of a field, options separated by commas:
+//
+//	rf:"-"                  the field is not read
+//	rf:"name=Col"           the column of the field is Col, the field name by default
+//	rf:"optional"           the column may be missing, an empty cell is the zero value
+//	rf:"default=x"          the value of a missing column or an empty cell, implies optional
+//	rf:"required"           the cell must not be empty
+//	rf:"min=1,max=9"        bounds of a number, of the length of a string, an array, a slice or a map
+//	rf:"enum=a|b|c"         the cell must be one of the values
+//	rf:"ref=drop.txt:byID"  a key of the index byID of the table drop.txt, see Manager
+//	rf:"regex=^\w+$"        the cell must match, regex must be the last option
+type fieldDef struct {
+	column     string
+	ignore     bool
+	optional   bool
+	def        string
+	hasDefault bool
+	required   bool
+	min, max   *float64
+	enum       []string
+	regex      *regexp.Regexp
+	refTable   string
+	refIndex   string
+}
+
+// splitTag the options of a rf tag, regex= takes the rest of the tag
+func splitTag(tag string) []string {
+	var opts []string
+	for tag != "" {
+		if strings.HasPrefix(tag, "regex=") {
+			return append(opts, tag)
+		}
+		i := strings.IndexByte(tag, ',')
+		if i < 0 {
+			return append(opts, tag)
+		}
+		opts = append(opts, tag[:i])
+		tag = tag[i+1:]
+	}
+	return opts
+}
+
+func parseFieldTags(typeRecord reflect.Type) ([]fieldDef, error) {
+	defs := make([]fieldDef, typeRecord.NumField())
+	for i := range defs {
+		f := typeRecord.Field(i)
+		def := &defs[i]
+		def.column = f.Name
+
+		tag, ok := f.Tag.Lookup("rf")
+		if !ok {
+			continue
+		}
+		for _, opt := range splitTag(tag) {
+			key, value := opt, ""
+			if j := strings.IndexByte(opt, '='); j >= 0 {
+				key, value = opt[:j], opt[j+1:]
+			}
+
+			var err error
+			switch key {
+			case "-":
+				def.ignore = true
+			case "name":
+				if value == "" {
+					err = errors.New("empty name")
+				}
+				def.column = value
+			case "optional":
+				def.optional = true
+			case "default":
+				def.optional = true
+				def.def = value
+				def.hasDefault = true
+			case "required":
+				def.required = true
+			case "min":
+				def.min, err = parseBound(value)
+			case "max":
+				def.max, err = parseBound(value)
+			case "enum":
+				def.enum = strings.Split(value, "|")
+			case "ref":
+				def.refTable, def.refIndex = value, ""
+				if j := strings.IndexByte(value, ':'); j >= 0 {
+					def.refTable, def.refIndex = value[:j], value[j+1:]
+				}
+				if def.refTable == "" {
+					err = errors.New("empty table")
+				}
+			case "regex":
+				def.regex, err = regexp.Compile(value)
+			case "index", "multi":
+			default:
+				err = errors.New("unknown option " + key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("field %v %v, tag %v: %v", i, f.Name, opt, err)
+			}
+		}
+
+		if def.min != nil || def.max != nil {
+			switch f.Type.Kind() {
+			case reflect.Bool, reflect.Struct:
+				return nil, fmt.Errorf("field %v %v: min and max do not apply to %v",
+					i, f.Name, f.Type.Kind())
+			}
+		}
+	}
+	return defs, nil
+}
+
+func parseBound(s string) (*float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// check the violations of the field, cell is the text it was parsed from.
+// An empty cell of an optional field is not checked
+func (def *fieldDef) check(field reflect.Value, cell string) []string {
+	var violations []string
+
+	if cell == "" {
+		if def.required {
+			return []string{"required"}
+		}
+		if def.optional {
+			return nil
+		}
+	}
+
+	if def.min != nil || def.max != nil {
+		var v float64
+		var what string
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v = float64(field.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v = float64(field.Uint())
+		case reflect.Float32, reflect.Float64:
+			v = field.Float()
+		default:
+			v = float64(field.Len())
+			what = "length "
+		}
+		if def.min != nil && v < *def.min {
+			violations = append(violations, fmt.Sprintf("%v%v < min %v", what, v, *def.min))
+		}
+		if def.max != nil && v > *def.max {
+			violations = append(violations, fmt.Sprintf("%v%v > max %v", what, v, *def.max))
+		}
+	}
+
+	if def.enum != nil {
+		found := false
+		for _, e := range def.enum {
+			if cell == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violations = append(violations, fmt.Sprintf("%q not in %v", cell, strings.Join(def.enum, "|")))
+		}
+	}
+
+	if def.regex != nil && !def.regex.MatchString(cell) {
+		violations = append(violations, fmt.Sprintf("%q does not match %v", cell, def.regex))
+	}
+
+	return violations
+}
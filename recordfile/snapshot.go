@@ -0,0 +1,155 @@
+package recordfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/zfiona/server-base/log"
+	"os"
+	"reflect"
+	"strconv"
+)
+
+// a snapshot: the magic, the schema hash of the record type, the number of
+// records, the row of each in the source and the records, see codec.go
+const snapshotMagic = "RFSNAP2\n"
+
+var ErrSchemaMismatch = errors.New("snapshot schema mismatch")
+
+// SchemaHash of the record type: the names, types and tags of the fields,
+// nested types included
+func (rf *RecordFile) SchemaHash() [sha256.Size]byte {
+	var b bytes.Buffer
+	describe(&b, rf.typeRecord)
+	return sha256.Sum256(b.Bytes())
+}
+
+func describe(b *bytes.Buffer, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Struct:
+		b.WriteString("struct{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			b.WriteString(f.Name)
+			b.WriteByte(' ')
+			describe(b, f.Type)
+			b.WriteByte(' ')
+			b.WriteString(strconv.Quote(string(f.Tag)))
+			b.WriteByte(';')
+		}
+		b.WriteByte('}')
+	case reflect.Array:
+		b.WriteString("[" + strconv.Itoa(t.Len()) + "]")
+		describe(b, t.Elem())
+	case reflect.Slice:
+		b.WriteString("[]")
+		describe(b, t.Elem())
+	case reflect.Map:
+		b.WriteString("map[")
+		describe(b, t.Key())
+		b.WriteByte(']')
+		describe(b, t.Elem())
+	default:
+		b.WriteString(t.Kind().String())
+	}
+}
+
+// WriteSnapshot the records read, to be loaded by ReadSnapshot. The fields
+// of the record type must be of the kinds of codec.go, not interfaces or
+// pointers
+func (rf *RecordFile) WriteSnapshot(name string) error {
+	encode, err := encoderOf(rf.typeRecord)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	enc := &encoder{buf: []byte(snapshotMagic)}
+	hash := rf.SchemaHash()
+	enc.buf = append(enc.buf, hash[:]...)
+	enc.uint(uint64(len(rf.records)))
+	for _, row := range rf.rowNums {
+		enc.uint(uint64(row))
+	}
+	for _, r := range rf.records {
+		encode(enc, reflect.ValueOf(r).Elem())
+	}
+
+	// atomic for the readers
+	tmp := name + ".tmp"
+	err = os.WriteFile(tmp, enc.buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// ReadSnapshot the records and the indexes from a snapshot written by
+// WriteSnapshot, ErrSchemaMismatch if the record type changed since
+func (rf *RecordFile) ReadSnapshot(name string) error {
+	decode, err := decoderOf(rf.typeRecord)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	n := len(snapshotMagic) + sha256.Size
+	if len(data) < n || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("%v: not a snapshot", name)
+	}
+	hash := rf.SchemaHash()
+	if !bytes.Equal(data[len(snapshotMagic):n], hash[:]) {
+		return ErrSchemaMismatch
+	}
+
+	dec := &decoder{buf: data[n:]}
+	count := dec.len()
+	rowNums := make([]int, count)
+	for i := range rowNums {
+		rowNums[i] = int(dec.uint())
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(rf.typeRecord), count, count)
+	records := make([]interface{}, count)
+	for i := range records {
+		record := slice.Index(i)
+		decode(dec, record)
+		records[i] = record.Addr().Interface()
+	}
+	if dec.err == nil && len(dec.buf) > 0 {
+		dec.err = errors.New("trailing data")
+	}
+	if dec.err != nil {
+		return fmt.Errorf("%v: %v", name, dec.err)
+	}
+
+	indexes, indexesByName, err := rf.makeIndexes(records, rowNums)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+
+	rf.records = records
+	rf.rowNums = rowNums
+	rf.indexes = indexes
+	rf.indexesByName = indexesByName
+
+	return nil
+}
+
+// ReadWithSnapshot the snapshot if it is up to date: not older than the
+// source, if any, and of the same schema. The source otherwise
+func (rf *RecordFile) ReadWithSnapshot(source, snapshot string) error {
+	info, err := os.Stat(snapshot)
+	if err == nil {
+		src, srcErr := os.Stat(source)
+		if srcErr == nil && src.ModTime().After(info.ModTime()) {
+			log.Release("snapshot %v older than %v, reading the source", snapshot, source)
+		} else if err = rf.ReadSnapshot(snapshot); err == nil {
+			return nil
+		} else {
+			log.Release("snapshot %v: %v, reading the source", snapshot, err)
+		}
+	}
+	return rf.Read(source)
+}
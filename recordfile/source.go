@@ -0,0 +1,244 @@
+package recordfile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tableRows the rows of a file as text cells, the first one is the header
+type tableRows struct {
+	rows [][]string
+	// the row of each in the file, from 1: its line in a text, JSON or
+	// YAML file
+	rowNums []int
+	// the columns must be mapped by name
+	byName bool
+}
+
+// readRows the format follows the extension: .xlsx, .json, .yaml, .yml or
+// delimited text
+func (rf *RecordFile) readRows(name string) (*tableRows, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xlsx":
+		return rf.readXLSX(name)
+	case ".json":
+		return readJSON(name)
+	case ".yaml", ".yml":
+		return readYAML(name)
+	default:
+		return rf.readText(name)
+	}
+}
+
+func (rf *RecordFile) readText(name string) (*tableRows, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if rf.Comma == 0 {
+		rf.Comma = Comma
+	}
+	if rf.Comment == 0 {
+		rf.Comment = Comment
+	}
+	reader := csv.NewReader(file)
+	reader.Comma = rf.Comma
+	reader.Comment = rf.Comment
+	reader.FieldsPerRecord = -1
+
+	t := new(tableRows)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		t.rows = append(t.rows, row)
+		t.rowNums = append(t.rowNums, line)
+	}
+}
+
+// readXLSX the sheet rf.Sheet or the first one, empty rows and rows
+// starting with rf.Comment are skipped
+func (rf *RecordFile) readXLSX(name string) (*tableRows, error) {
+	f, err := excelize.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheet := rf.Sheet
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	}
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	if rf.Comment == 0 {
+		rf.Comment = Comment
+	}
+	t := new(tableRows)
+	for i, row := range rows {
+		if len(row) == 0 || strings.HasPrefix(row[0], string(rf.Comment)) {
+			continue
+		}
+		t.rows = append(t.rows, row)
+		t.rowNums = append(t.rowNums, i+1)
+	}
+	return t, nil
+}
+
+// readJSON an array of objects
+func readJSON(name string) (*tableRows, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("%v: not an array of objects", name)
+	}
+
+	var objects []map[string]interface{}
+	var lines []int
+	line, offset := 1, 0
+	for decoder.More() {
+		// the line of the object
+		next := int(decoder.InputOffset())
+		for next < len(data) && strings.IndexByte(" \t\r\n,", data[next]) >= 0 {
+			next++
+		}
+		line += bytes.Count(data[offset:next], []byte("\n"))
+		offset = next
+
+		var o map[string]interface{}
+		err = decoder.Decode(&o)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+		lines = append(lines, line)
+	}
+	_, err = decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	return objectRows(name, objects, lines)
+}
+
+// readYAML a sequence of mappings
+func readYAML(name string) (*tableRows, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]interface{}
+	err = doc.Decode(&objects)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]int, len(objects))
+	if len(objects) > 0 {
+		for i, item := range doc.Content[0].Content {
+			lines[i] = item.Line
+		}
+	}
+	return objectRows(name, objects, lines)
+}
+
+// objectRows the header is the sorted keys of all objects, a missing key is
+// an empty cell. lines the line of each object
+func objectRows(name string, objects []map[string]interface{}, lines []int) (*tableRows, error) {
+	columns := make(map[string]int)
+	var header []string
+	for _, o := range objects {
+		for k := range o {
+			if _, ok := columns[k]; !ok {
+				columns[k] = 0
+				header = append(header, k)
+			}
+		}
+	}
+	sort.Strings(header)
+	for i, k := range header {
+		columns[k] = i
+	}
+
+	t := &tableRows{byName: true}
+	t.rows = make([][]string, 1, len(objects)+1)
+	t.rows[0] = header
+	t.rowNums = make([]int, 1, len(objects)+1)
+	t.rowNums[0] = 1
+	for n, o := range objects {
+		row := make([]string, len(header))
+		for k, v := range o {
+			cell, err := cellString(v)
+			if err != nil {
+				return nil, fmt.Errorf("%v (row=%v, col=%v): %v", name, lines[n], k, err)
+			}
+			row[columns[k]] = cell
+		}
+		t.rows = append(t.rows, row)
+		t.rowNums = append(t.rowNums, lines[n])
+	}
+	return t, nil
+}
+
+// cellString the text of a decoded value, as written in a text table
+func cellString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	case map[interface{}]interface{}:
+		return "", errors.New("map keys must be strings")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -1,25 +1,75 @@
 package server
 
 import (
+	"context"
 	"github.com/zfiona/server-base/conf"
+	"github.com/zfiona/server-base/conf/live"
 	"github.com/zfiona/server-base/log"
 	"github.com/zfiona/server-base/module"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 )
 
 const version = "1.0.0"
 
+var (
+	closeOnce sync.Once
+	closeChan = make(chan struct{})
+	doneChan  = make(chan struct{})
+)
+
 func Run(mods ...module.Module) {
 	// logger
 	if conf.LogLevel != "" {
-		logger, err := log.New(conf.LogLevel, conf.LogPath, conf.LogFlag)
+		logger, err := log.NewWithOptions(conf.LogLevel, conf.LogPath, conf.LogFlag, log.FileOptions{
+			Name:       conf.LogName,
+			MaxSize:    int64(conf.LogMaxSize) * 1024 * 1024,
+			Interval:   conf.LogRotate,
+			Compress:   conf.LogCompress,
+			MaxBackups: conf.LogMaxBackups,
+			MaxAge:     conf.LogMaxAge,
+		})
+		if err != nil {
+			panic(err)
+		}
+		encoder, err := log.NewEncoder(conf.LogFormat)
 		if err != nil {
 			panic(err)
 		}
+		logger.SetEncoder(encoder)
+		if conf.LogStdout && conf.LogPath != "" {
+			err = logger.AddSink(log.Sink{Writer: os.Stdout})
+			if err != nil {
+				panic(err)
+			}
+		}
+		if conf.LogNetwork != "" {
+			w, err := log.DialNet(conf.LogNetwork, conf.LogAddr)
+			if err != nil {
+				panic(err)
+			}
+			s := log.Sink{Writer: w, Level: conf.LogNetLevel}
+			if conf.LogSyslog {
+				s.Encoder = log.NewSyslogEncoder(encoder, 16, "")
+			}
+			err = logger.AddSink(s)
+			if err != nil {
+				panic(err)
+			}
+		}
+		if conf.LogAsyncSize > 0 {
+			err = logger.SetAsync(conf.LogAsyncSize, conf.LogAsyncPolicy)
+			if err != nil {
+				panic(err)
+			}
+		}
 		log.Export(logger)
 		defer logger.Close()
 	}
+	slog.SetDefault(slog.New(log.NewHandler(nil)))
 
 	log.Release("server %v starting up", version)
 
@@ -29,10 +79,46 @@ func Run(mods ...module.Module) {
 	}
 	module.Init()
 
-	// close
+	// close, SIGHUP reloads the configuration
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	sig := <-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		select {
+		case sig := <-c:
+			if sig == syscall.SIGHUP {
+				log.Release("server reloading configuration (signal: %v)", sig)
+				err := live.Reload()
+				if err != nil {
+					log.Error("%v, old configuration kept", err)
+				}
+				continue
+			}
+			log.Release("server closing down (signal: %v)", sig)
+		case <-closeChan:
+			log.Release("server closing down (shutdown)")
+		}
+		break
+	}
+	signal.Stop(c)
+
 	module.Destroy()
-	log.Release("server closing down (signal: %v)", sig)
+	log.Release("server closed")
+	close(doneChan)
+}
+
+// Shutdown goroutine safe
+// closes the running server and waits until all modules are destroyed
+// or ctx is done. Do not wait on it from a module goroutine, Destroy
+// would wait for that module in turn
+func Shutdown(ctx context.Context) error {
+	closeOnce.Do(func() {
+		close(closeChan)
+	})
+
+	select {
+	case <-doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,164 @@
+package timer
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Clock the source of time of a Dispatcher
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after d
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+type ClockTimer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// RealClock the wall clock, backed by runtime timers
+var RealClock Clock = realClock{}
+
+// ManualClock a clock only moved by Advance, for deterministic tests
+type ManualClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers manualTimers
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	c := new(ManualClock)
+	c.now = now
+	return c
+}
+
+// Now goroutine safe
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// AfterFunc goroutine safe
+// f is called by Advance, a timer with d <= 0 fires on the next Advance
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.seq++
+	t := &manualTimer{
+		clock: c,
+		when:  c.now.Add(d),
+		seq:   c.seq,
+		f:     f,
+	}
+	heap.Push(&c.timers, t)
+	return t
+}
+
+// Advance goroutine safe
+// moves the clock forward by d and calls f of every due timer in the
+// calling goroutine, in order of expiration. Now returns the expiration
+// of a timer while it fires, timers armed meanwhile also fire if due.
+// A Dispatcher delivers fired timers to ChanTimer, so ChanTimer must be
+// large enough or drained by another goroutine. A cron is armed again by
+// its callback: advance to each expiration in turn, see Next, and drain
+// ChanTimer in between for every run
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	target := c.now.Add(d)
+	for len(c.timers) > 0 && !c.timers[0].when.After(target) {
+		t := heap.Pop(&c.timers).(*manualTimer)
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+
+		c.mutex.Unlock()
+		t.f()
+		c.mutex.Lock()
+	}
+	if target.After(c.now) {
+		c.now = target
+	}
+}
+
+// Next goroutine safe
+// the expiration of the first pending timer, false if none
+func (c *ManualClock) Next() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[0].when, true
+}
+
+type manualTimer struct {
+	clock *ManualClock
+	when  time.Time
+	seq   uint64
+	f     func()
+	index int
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&c.timers, t.index)
+	return true
+}
+
+// manualTimers a min-heap ordered by expiration, then by arming order
+type manualTimers []*manualTimer
+
+func (ts manualTimers) Len() int {
+	return len(ts)
+}
+
+func (ts manualTimers) Less(i, j int) bool {
+	if ts[i].when.Equal(ts[j].when) {
+		return ts[i].seq < ts[j].seq
+	}
+	return ts[i].when.Before(ts[j].when)
+}
+
+func (ts manualTimers) Swap(i, j int) {
+	ts[i], ts[j] = ts[j], ts[i]
+	ts[i].index = i
+	ts[j].index = j
+}
+
+func (ts *manualTimers) Push(x interface{}) {
+	t := x.(*manualTimer)
+	t.index = len(*ts)
+	*ts = append(*ts, t)
+}
+
+func (ts *manualTimers) Pop() interface{} {
+	old := *ts
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*ts = old[:len(old)-1]
+	return t
+}
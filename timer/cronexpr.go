@@ -10,14 +10,31 @@ import (
 )
 
 // CronExpr
-//Field name   | Mandatory? | Allowed values | Allowed special characters
-// ----------   | ---------- | -------------- | --------------------------
-// Seconds      | No         | 0-59           | * / , -
-// Minutes      | Yes        | 0-59           | * / , -
-// Hours        | Yes        | 0-23           | * / , -
-// Day of month | Yes        | 1-31           | * / , -
-// Month        | Yes        | 1-12           | * / , -
-// Day of week  | Yes        | 0-6            | * / , -
+// Field name   | Mandatory? | Allowed values  | Allowed special characters
+// ----------   | ---------- | --------------  | --------------------------
+// Seconds      | No         | 0-59            | * / , -
+// Minutes      | Yes        | 0-59            | * / , -
+// Hours        | Yes        | 0-23            | * / , -
+// Day of month | Yes        | 1-31            | * / , - ? L W
+// Month        | Yes        | 1-12 or JAN-DEC | * / , -
+// Day of week  | Yes        | 0-6 or SUN-SAT  | * / , - ? L #
+//
+// L   day of month: the last day of the month, LW the last weekday
+// nW  day of month: the weekday nearest to day n, within the month
+// nL  day of week: the last weekday n of the month, e.g. 5L, FRIL
+// n#k day of week: the k-th weekday n of the month, e.g. 1#1, MON#1
+// ?   the same as *
+//
+// Predefined: @yearly (@annually), @monthly, @weekly, @daily (@midnight),
+// @hourly and @every <duration>, e.g. @every 1h30m
+//
+// An expression may start with CRON_TZ=<zone> (or TZ=<zone>), otherwise it
+// is evaluated in the location of the time passed to Next.
+//
+// The fields are matched against the wall clock of the location:
+// a time skipped when the clocks go forward (DST starts) does not fire
+// that day, a time repeated when the clocks go back (DST ends) fires once,
+// at its first occurrence. @every is not affected by DST
 type CronExpr struct {
 	sec   uint64
 	min   uint64
@@ -25,11 +42,69 @@ type CronExpr struct {
 	dom   uint64
 	month uint64
 	dow   uint64
+
+	domLast        bool     // L
+	domLastWeekday bool     // LW
+	domWeekday     uint64   // nW, bit n
+	dowLast        uint64   // nL, bit n
+	dowNth         [7]uint8 // n#k, bit k of dowNth[n]
+
+	every time.Duration
+	loc   *time.Location
+}
+
+var monthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var dowNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
 }
 
 // NewCronExpr goroutine safe
 func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
+	return NewCronExprIn(expr, nil)
+}
+
+// NewCronExprIn goroutine safe
+// loc is overridden by a CRON_TZ=<zone> prefix of expr
+func NewCronExprIn(expr string, loc *time.Location) (cronExpr *CronExpr, err error) {
 	fields := strings.Fields(expr)
+
+	// time zone
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "CRON_TZ=") || strings.HasPrefix(fields[0], "TZ=")) {
+		name := fields[0][strings.Index(fields[0], "=")+1:]
+		loc, err = time.LoadLocation(name)
+		if err != nil {
+			err = fmt.Errorf("invalid expr %v: %v", expr, err)
+			return
+		}
+		fields = fields[1:]
+	}
+
+	// predefined
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		if fields[0] == "@every" {
+			return parseEvery(expr, fields, loc)
+		}
+		if len(fields) != 1 || cronMacros[fields[0]] == "" {
+			err = fmt.Errorf("invalid expr %v: unknown descriptor %v", expr, fields[0])
+			return
+		}
+		fields = strings.Fields(cronMacros[fields[0]])
+	}
+
 	if len(fields) != 5 && len(fields) != 6 {
 		err = fmt.Errorf("invalid expr %v: expected 5 or 6 fields, got %v", expr, len(fields))
 		return
@@ -40,33 +115,34 @@ func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
 	}
 
 	cronExpr = new(CronExpr)
+	cronExpr.loc = loc
 	// Seconds
-	cronExpr.sec, err = parseCronField(fields[0], 0, 59)
+	cronExpr.sec, err = parseCronField(fields[0], 0, 59, nil)
 	if err != nil {
 		goto onError
 	}
 	// Minutes
-	cronExpr.min, err = parseCronField(fields[1], 0, 59)
+	cronExpr.min, err = parseCronField(fields[1], 0, 59, nil)
 	if err != nil {
 		goto onError
 	}
 	// Hours
-	cronExpr.hour, err = parseCronField(fields[2], 0, 23)
+	cronExpr.hour, err = parseCronField(fields[2], 0, 23, nil)
 	if err != nil {
 		goto onError
 	}
 	// Day of month
-	cronExpr.dom, err = parseCronField(fields[3], 1, 31)
+	err = cronExpr.parseDom(fields[3])
 	if err != nil {
 		goto onError
 	}
 	// Month
-	cronExpr.month, err = parseCronField(fields[4], 1, 12)
+	cronExpr.month, err = parseCronField(fields[4], 1, 12, monthNames)
 	if err != nil {
 		goto onError
 	}
 	// Day of week
-	cronExpr.dow, err = parseCronField(fields[5], 0, 6)
+	err = cronExpr.parseDow(fields[5])
 	if err != nil {
 		goto onError
 	}
@@ -77,13 +153,111 @@ onError:
 	return
 }
 
+func parseEvery(expr string, fields []string, loc *time.Location) (cronExpr *CronExpr, err error) {
+	if len(fields) != 2 {
+		err = fmt.Errorf("invalid expr %v: expected @every <duration>", expr)
+		return
+	}
+	d, err := time.ParseDuration(fields[1])
+	if err != nil {
+		err = fmt.Errorf("invalid expr %v: %v", expr, err)
+		return
+	}
+	d = d.Truncate(time.Second)
+	if d <= 0 {
+		err = fmt.Errorf("invalid expr %v: duration must be at least 1s", expr)
+		return
+	}
+
+	cronExpr = new(CronExpr)
+	cronExpr.every = d
+	cronExpr.loc = loc
+	return
+}
+
+func (e *CronExpr) parseDom(field string) (err error) {
+	if field == "?" {
+		field = "*"
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		switch {
+		case part == "L":
+			e.domLast = true
+		case part == "LW":
+			e.domLastWeekday = true
+		case strings.HasSuffix(part, "W"):
+			var day int
+			day, err = strconv.Atoi(strings.TrimSuffix(part, "W"))
+			if err != nil || day < 1 || day > 31 {
+				return fmt.Errorf("invalid nearest weekday: %v", part)
+			}
+			e.domWeekday |= 1 << uint(day)
+		default:
+			var dom uint64
+			dom, err = parseCronField(part, 1, 31, nil)
+			if err != nil {
+				return
+			}
+			e.dom |= dom
+		}
+	}
+	return
+}
+
+func (e *CronExpr) parseDow(field string) (err error) {
+	if field == "?" {
+		field = "*"
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		switch {
+		case strings.Contains(part, "#"):
+			nth := strings.Split(part, "#")
+			var dow, k int
+			dow, err = parseCronValue(nth[0], dowNames)
+			if err != nil || dow < 0 || dow > 6 {
+				return fmt.Errorf("invalid nth weekday: %v", part)
+			}
+			k, err = strconv.Atoi(nth[1])
+			if err != nil || len(nth) != 2 || k < 1 || k > 5 {
+				return fmt.Errorf("invalid nth weekday: %v", part)
+			}
+			e.dowNth[dow] |= 1 << uint(k)
+		case len(part) > 1 && strings.HasSuffix(part, "L"):
+			var dow int
+			dow, err = parseCronValue(strings.TrimSuffix(part, "L"), dowNames)
+			if err != nil || dow < 0 || dow > 6 {
+				return fmt.Errorf("invalid last weekday: %v", part)
+			}
+			e.dowLast |= 1 << uint(dow)
+		default:
+			var dow uint64
+			dow, err = parseCronField(part, 0, 6, dowNames)
+			if err != nil {
+				return
+			}
+			e.dow |= dow
+		}
+	}
+	return
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	return strconv.Atoi(s)
+}
+
 // 1. *
 // 2. num
 // 3. num-num
 // 4. */num
 // 5. num/num (means num-max/num)
 // 6. num-num/num
-func parseCronField(field string, min int, max int) (cronField uint64, err error) {
+// num may be a name
+func parseCronField(field string, min int, max int, names map[string]int) (cronField uint64, err error) {
 	fields := strings.Split(field, ",")
 	for _, field := range fields {
 		rangeAndIncr := strings.Split(field, "/")
@@ -109,7 +283,7 @@ func parseCronField(field string, min int, max int) (cronField uint64, err error
 			end = max
 		} else {
 			// start
-			start, err = strconv.Atoi(startAndEnd[0])
+			start, err = parseCronValue(startAndEnd[0], names)
 			if err != nil {
 				err = fmt.Errorf("invalid range: %v", rangeAndIncr[0])
 				return
@@ -122,7 +296,7 @@ func parseCronField(field string, min int, max int) (cronField uint64, err error
 					end = start
 				}
 			} else {
-				end, err = strconv.Atoi(startAndEnd[1])
+				end, err = parseCronValue(startAndEnd[1], names)
 				if err != nil {
 					err = fmt.Errorf("invalid range: %v", rangeAndIncr[0])
 					return
@@ -172,98 +346,195 @@ func parseCronField(field string, min int, max int) (cronField uint64, err error
 	return
 }
 
+// Location the location of the expression, nil if it follows the time
+// passed to Next
+func (e *CronExpr) Location() *time.Location {
+	return e.loc
+}
+
+func lastDay(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func weekday(year int, month time.Month, day int) time.Weekday {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday()
+}
+
+// the weekday nearest to day, not crossing the month
+func nearestWeekday(year int, month time.Month, day int, last int) int {
+	switch weekday(year, month, day) {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+		return day - 1
+	case time.Sunday:
+		if day == last {
+			return day - 2
+		}
+		return day + 1
+	}
+	return day
+}
+
+func (e *CronExpr) matchDom(t time.Time) bool {
+	day := t.Day()
+	if 1<<uint(day)&e.dom != 0 {
+		return true
+	}
+
+	last := lastDay(t)
+	if e.domLast && day == last {
+		return true
+	}
+	if e.domLastWeekday && day == nearestWeekday(t.Year(), t.Month(), last, last) {
+		return true
+	}
+	for n := 1; n <= last; n++ {
+		if 1<<uint(n)&e.domWeekday != 0 && day == nearestWeekday(t.Year(), t.Month(), n, last) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *CronExpr) matchDow(t time.Time) bool {
+	wd := t.Weekday()
+	if 1<<uint(wd)&e.dow != 0 {
+		return true
+	}
+	if 1<<uint(wd)&e.dowLast != 0 && t.Day()+7 > lastDay(t) {
+		return true
+	}
+	return 1<<uint((t.Day()-1)/7+1)&e.dowNth[wd] != 0
+}
+
 func (e *CronExpr) matchDay(t time.Time) bool {
+	domBlank := e.dom == 0xfffffffe && !e.domLast && !e.domLastWeekday && e.domWeekday == 0
+	dowBlank := e.dow == 0x7f && e.dowLast == 0 && e.dowNth == [7]uint8{}
+
 	// day-of-month blank
-	if e.dom == 0xfffffffe {
-		return 1<<uint(t.Weekday())&e.dow != 0
+	if domBlank {
+		return e.matchDow(t)
 	}
 
 	// day-of-week blank
-	if e.dow == 0x7f {
-		return 1<<uint(t.Day())&e.dom != 0
+	if dowBlank {
+		return e.matchDom(t)
+	}
+
+	return e.matchDow(t) || e.matchDom(t)
+}
+
+// repeated returns how far back the first occurrence of the wall clock of t
+// is, if t is seen for the second time after the clocks go back
+func repeated(t time.Time) time.Duration {
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return 0
+	}
+
+	_, offset := t.Zone()
+	_, prevOffset := start.Add(-time.Second).Zone()
+	shift := time.Duration(prevOffset-offset) * time.Second
+	if shift > 0 && t.Sub(start) < shift {
+		return shift
 	}
+	return 0
+}
+
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
 
-	return 1<<uint(t.Weekday())&e.dow != 0 ||
-		1<<uint(t.Day())&e.dom != 0
+// date the first occurrence of a wall clock time, or the end of the gap
+// if the wall clock time is skipped when the clocks go forward
+func date(year int, month time.Month, day, hour, min, sec int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, loc)
+	wall := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	if w := wallClock(t); w.Before(wall) {
+		_, t = t.ZoneBounds()
+	} else if w.After(wall) {
+		t, _ = t.ZoneBounds()
+	}
+	return t.Add(-repeated(t))
 }
 
 // goroutine safe
 func (e *CronExpr) Next(t time.Time) time.Time {
+	if e.every > 0 {
+		return t.Truncate(time.Second).Add(e.every)
+	}
+
+	loc := e.loc
+	if loc == nil {
+		loc = t.Location()
+	}
+	t = t.In(loc)
+	origin := t
+
 	// the upcoming second
 	t = t.Truncate(time.Second).Add(time.Second)
 
+	// any combination of days repeats within 28 years
 	year := t.Year()
-	initFlag := false
 
 retry:
 	// Year
-	if t.Year() > year+1 {
+	if t.Year() > year+28 {
 		return time.Time{}
 	}
 
 	// Month
 	for 1<<uint(t.Month())&e.month == 0 {
-		if !initFlag {
-			initFlag = true
-			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
-		}
-
-		t = t.AddDate(0, 1, 0)
-		if t.Month() == time.January {
+		y := t.Year()
+		t = date(y, t.Month()+1, 1, 0, 0, 0, loc)
+		if t.Year() != y {
 			goto retry
 		}
 	}
 
 	// Day
 	for !e.matchDay(t) {
-		if !initFlag {
-			initFlag = true
-			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
-		}
-
-		t = t.AddDate(0, 0, 1)
-		if t.Day() == 1 {
+		m := t.Month()
+		t = date(t.Year(), m, t.Day()+1, 0, 0, 0, loc)
+		if t.Month() != m {
 			goto retry
 		}
 	}
 
 	// Hours
 	for 1<<uint(t.Hour())&e.hour == 0 {
-		if !initFlag {
-			initFlag = true
-			t = t.Truncate(time.Hour)
-		}
-
-		t = t.Add(time.Hour)
-		if t.Hour() == 0 {
+		d := t.Day()
+		t = date(t.Year(), t.Month(), d, t.Hour()+1, 0, 0, loc)
+		if t.Day() != d {
 			goto retry
 		}
 	}
 
 	// Minutes
 	for 1<<uint(t.Minute())&e.min == 0 {
-		if !initFlag {
-			initFlag = true
-			t = t.Truncate(time.Minute)
-		}
-
-		t = t.Add(time.Minute)
-		if t.Minute() == 0 {
+		h := t.Hour()
+		t = date(t.Year(), t.Month(), t.Day(), h, t.Minute()+1, 0, loc)
+		if t.Hour() != h {
 			goto retry
 		}
 	}
 
 	// Seconds
 	for 1<<uint(t.Second())&e.sec == 0 {
-		if !initFlag {
-			initFlag = true
-		}
-
-		t = t.Add(time.Second)
-		if t.Second() == 0 {
+		m := t.Minute()
+		t = date(t.Year(), t.Month(), t.Day(), t.Hour(), m, t.Second()+1, loc)
+		if t.Minute() != m {
 			goto retry
 		}
 	}
 
+	// DST
+	if !t.After(origin) || repeated(t) > 0 {
+		t = date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second()+1, loc)
+		goto retry
+	}
+
 	return t
 }
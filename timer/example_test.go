@@ -6,6 +6,29 @@ import (
 	"time"
 )
 
+// advance moves the clock forward by by, to the expiration of every timer in
+// turn, and runs the timers delivered to ChanTimer as the goroutine of the
+// dispatcher would: a cron is armed again before its next run is due
+func advance(clock *timer.ManualClock, d *timer.Dispatcher, by time.Duration) {
+	target := clock.Now().Add(by)
+	for {
+		next, ok := clock.Next()
+		if !ok || next.After(target) {
+			break
+		}
+		clock.Advance(next.Sub(clock.Now()))
+		drain(d)
+	}
+	clock.Advance(target.Sub(clock.Now()))
+	drain(d)
+}
+
+func drain(d *timer.Dispatcher) {
+	for len(d.ChanTimer) > 0 {
+		(<-d.ChanTimer).Cb()
+	}
+}
+
 func ExampleTimer() {
 	d := timer.NewDispatcher(10)
 
@@ -43,6 +66,32 @@ func ExampleCronExpr() {
 	// 2000-01-01 21:00:00 +0000 UTC
 }
 
+func ExampleNewCronExprIn() {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	from := time.Date(2000, 1, 1, 20, 10, 5, 0, time.UTC)
+
+	for _, expr := range []string{
+		"@daily",
+		"0 0 L * ?",
+		"0 10 ? * MON#2",
+		"0 0 ? JAN-MAR FRIL",
+		"@every 90m",
+	} {
+		cronExpr, err := timer.NewCronExprIn(expr, loc)
+		if err != nil {
+			return
+		}
+		fmt.Println(cronExpr.Next(from))
+	}
+
+	// Output:
+	// 2000-01-03 00:00:00 +0800 UTC+8
+	// 2000-01-31 00:00:00 +0800 UTC+8
+	// 2000-01-10 10:00:00 +0800 UTC+8
+	// 2000-01-28 00:00:00 +0800 UTC+8
+	// 2000-01-01 21:40:05 +0000 UTC
+}
+
 func ExampleCron() {
 	d := timer.NewDispatcher(10)
 
@@ -65,3 +114,183 @@ func ExampleCron() {
 	// Output:
 	// My name is Leaf
 }
+
+func ExampleNewWheelDispatcher() {
+	d := timer.NewWheelDispatcher(10, time.Millisecond)
+	defer d.Close()
+
+	// timer 1
+	d.AfterFunc(20*time.Millisecond, func() {
+		fmt.Println("20ms")
+	})
+
+	// timer 2
+	d.AfterFunc(10*time.Millisecond, func() {
+		fmt.Println("10ms")
+	})
+
+	// timer 3
+	t := d.AfterFunc(5*time.Millisecond, func() {
+		fmt.Println("will not print")
+	})
+	t.Stop()
+
+	// dispatch
+	(<-d.ChanTimer).Cb()
+	(<-d.ChanTimer).Cb()
+
+	// Output:
+	// 10ms
+	// 20ms
+}
+
+func ExampleManualClock() {
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 1,
+		23, 0, 0,
+		0, time.UTC,
+	))
+	d := timer.NewDispatcherWithClock(10, clock)
+
+	// daily reset
+	cronExpr, err := timer.NewCronExpr("0 0 * * *")
+	if err != nil {
+		return
+	}
+	d.CronFunc(cronExpr, func() {
+		fmt.Println("daily reset", d.Now())
+	})
+
+	// buff
+	d.AfterFunc(30*time.Minute, func() {
+		fmt.Println("buff expired", d.Now())
+	})
+
+	for i := 0; i < 2; i++ {
+		advance(clock, d, 24*time.Hour)
+	}
+
+	// Output:
+	// buff expired 2000-01-01 23:30:00 +0000 UTC
+	// daily reset 2000-01-02 00:00:00 +0000 UTC
+	// daily reset 2000-01-03 00:00:00 +0000 UTC
+}
+
+func ExampleManualClock_Advance() {
+	start := time.Date(
+		2000, 1, 1,
+		12, 0, 0,
+		0, time.UTC,
+	)
+	cronExpr, err := timer.NewCronExpr("0 0 * * *")
+	if err != nil {
+		return
+	}
+
+	// the timers are delivered to ChanTimer, the wheel fires on its ticks
+	for _, wheel := range []bool{false, true} {
+		clock := timer.NewManualClock(start)
+		d := timer.NewDispatcherWithClock(10, clock)
+		if wheel {
+			d = timer.NewWheelDispatcherWithClock(10, time.Second, clock)
+		}
+		d.CronFunc(cronExpr, func() {
+			fmt.Println("daily reset", d.Now())
+		})
+
+		advance(clock, d, 72*time.Hour)
+		fmt.Println("now", d.Now())
+		d.Close()
+	}
+
+	// Output:
+	// daily reset 2000-01-02 00:00:00 +0000 UTC
+	// daily reset 2000-01-03 00:00:00 +0000 UTC
+	// daily reset 2000-01-04 00:00:00 +0000 UTC
+	// now 2000-01-04 12:00:00 +0000 UTC
+	// daily reset 2000-01-02 00:00:00 +0000 UTC
+	// daily reset 2000-01-03 00:00:00 +0000 UTC
+	// daily reset 2000-01-04 00:00:00 +0000 UTC
+	// now 2000-01-04 12:00:00 +0000 UTC
+}
+
+func ExampleNewWheelDispatcherWithClock() {
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 1,
+		0, 0, 0,
+		0, time.UTC,
+	))
+	d := timer.NewWheelDispatcherWithClock(10, time.Millisecond, clock)
+	defer d.Close()
+
+	// idle for a week, the idle ticks are skipped
+	advance(clock, d, 7*24*time.Hour)
+
+	start := time.Now()
+	d.AfterFunc(time.Second, func() {
+		fmt.Println("fired", d.Now())
+	})
+	advance(clock, d, time.Second)
+	fmt.Println(time.Since(start) < 100*time.Millisecond)
+
+	// Output:
+	// fired 2000-01-08 00:00:01 +0000 UTC
+	// true
+}
+
+func ExampleDispatcher_TickerFunc() {
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 1,
+		0, 0, 0,
+		0, time.UTC,
+	))
+	d := timer.NewDispatcherWithClock(10, clock)
+
+	// room tick, the first one takes 350ms
+	busy := true
+	d.TickerFunc(100*time.Millisecond, timer.FixedRate, func(missed int) {
+		fmt.Println("tick", d.Now().Format("15:04:05.000"), "missed", missed)
+		if busy {
+			busy = false
+			clock.Advance(350 * time.Millisecond)
+		}
+	})
+
+	advance(clock, d, 100*time.Millisecond)
+	advance(clock, d, 50*time.Millisecond)
+
+	// Output:
+	// tick 00:00:00.100 missed 0
+	// tick 00:00:00.450 missed 2
+	// tick 00:00:00.500 missed 0
+}
+
+func ExampleTimer_Reset() {
+	clock := timer.NewManualClock(time.Date(
+		2000, 1, 1,
+		0, 0, 0,
+		0, time.UTC,
+	))
+	d := timer.NewDispatcherWithClock(10, clock)
+
+	// idle kick
+	t := d.AfterFunc(time.Minute, func() {
+		fmt.Println("kicked", d.Now().Format("15:04:05"))
+	})
+
+	advance(clock, d, 40*time.Second)
+	fmt.Println("remaining", t.Remaining())
+
+	// the player did something
+	t.Reset(time.Minute)
+	fmt.Println("remaining", t.Remaining())
+
+	advance(clock, d, time.Minute)
+	fmt.Println("remaining", t.Remaining())
+
+	// Output:
+	// remaining 20s
+	// remaining 1m0s
+	// kicked 00:01:40
+	// remaining 0s
+}
@@ -1,6 +1,7 @@
 package timer
 
 import (
+	"container/list"
 	"github.com/zfiona/server-base/conf"
 	"github.com/zfiona/server-base/log"
 	"runtime"
@@ -10,27 +11,117 @@ import (
 // Dispatcher one dispatcher per goroutine (goroutine not safe)
 type Dispatcher struct {
 	ChanTimer chan *Timer
+	clock     Clock
+	wheel     *wheel
 }
 
 func NewDispatcher(l int) *Dispatcher {
+	return NewDispatcherWithClock(l, RealClock)
+}
+
+func NewDispatcherWithClock(l int, clock Clock) *Dispatcher {
 	disp := new(Dispatcher)
 	disp.ChanTimer = make(chan *Timer, l)
+	disp.clock = clock
+	return disp
+}
+
+// NewWheelDispatcher a dispatcher backed by a hierarchical timing wheel
+// instead of one runtime timer per call, timers fire on the first tick at
+// or after their expiration
+func NewWheelDispatcher(l int, tick time.Duration) *Dispatcher {
+	return NewWheelDispatcherWithClock(l, tick, RealClock)
+}
+
+func NewWheelDispatcherWithClock(l int, tick time.Duration, clock Clock) *Dispatcher {
+	if tick <= 0 {
+		panic("invalid tick")
+	}
+
+	disp := NewDispatcherWithClock(l, clock)
+	disp.wheel = newWheel(clock, tick, disp.ChanTimer)
 	return disp
 }
 
+// Close stops the timing wheel, pending timers will not fire
+func (disp *Dispatcher) Close() {
+	if disp.wheel != nil {
+		disp.wheel.close()
+	}
+}
+
+// Now the time of the clock of the dispatcher
+func (disp *Dispatcher) Now() time.Time {
+	return disp.clock.Now()
+}
+
 type Timer struct {
-	t  *time.Timer
+	t  ClockTimer
 	cb func()
+
+	disp  *Dispatcher
+	f     func()
+	when  time.Time
+	armed int // deliveries not consumed by Cb yet
+
+	// timing wheel
+	wheel   *wheel
+	expires uint64
+	slot    *list.List
+	elem    *list.Element
+}
+
+func (t *Timer) arm(d time.Duration) {
+	disp := t.disp
+	t.cb = t.f
+	t.when = disp.clock.Now().Add(d)
+	t.armed++
+	if disp.wheel != nil {
+		t.wheel = disp.wheel
+		t.wheel.add(t, d)
+		return
+	}
+	t.t = disp.clock.AfterFunc(d, func() {
+		disp.ChanTimer <- t
+	})
 }
 
 func (t *Timer) Stop() {
-	t.t.Stop()
+	var stopped bool
+	if t.wheel != nil {
+		stopped = t.wheel.remove(t)
+	} else {
+		stopped = t.t.Stop()
+	}
+	if stopped {
+		t.armed--
+	}
 	t.cb = nil
 }
 
+// Reset the timer expires after d with the same callback, whether it has
+// fired, has been stopped or is pending. A pending expiration is dropped
+// even if it is already in ChanTimer
+func (t *Timer) Reset(d time.Duration) {
+	t.Stop()
+	t.arm(d)
+}
+
+// Remaining the time before the timer expires, 0 if it has fired or has
+// been stopped
+func (t *Timer) Remaining() time.Duration {
+	if t.cb == nil {
+		return 0
+	}
+	d := t.when.Sub(t.disp.clock.Now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
 func (t *Timer) Cb() {
 	defer func() {
-		t.cb = nil
 		if r := recover(); r != nil {
 			if conf.LenStackBuf > 0 {
 				buf := make([]byte, conf.LenStackBuf)
@@ -42,17 +133,26 @@ func (t *Timer) Cb() {
 		}
 	}()
 
-	if t.cb != nil {
-		t.cb()
+	if t.armed > 0 {
+		t.armed--
+	}
+	// superseded by Reset
+	if t.armed > 0 {
+		return
+	}
+
+	cb := t.cb
+	t.cb = nil
+	if cb != nil {
+		cb()
 	}
 }
 
 func (disp *Dispatcher) AfterFunc(d time.Duration, cb func()) *Timer {
 	t := new(Timer)
-	t.cb = cb
-	t.t = time.AfterFunc(d, func() {
-		disp.ChanTimer <- t
-	})
+	t.disp = disp
+	t.f = cb
+	t.arm(d)
 	return t
 }
 
@@ -66,10 +166,12 @@ func (c *Cron) Stop() {
 	}
 }
 
+// CronFunc the schedule follows the location of cronExpr, if any,
+// otherwise the location of the clock
 func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
 	c := new(Cron)
 
-	now := time.Now()
+	now := disp.clock.Now()
 	nextTime := cronExpr.Next(now)
 	if nextTime.IsZero() {
 		return c
@@ -80,7 +182,7 @@ func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
 	cb = func() {
 		defer _cb()
 
-		now := time.Now()
+		now := disp.clock.Now()
 		nextTime := cronExpr.Next(now)
 		if nextTime.IsZero() {
 			return
@@ -91,3 +193,80 @@ func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
 	c.t = disp.AfterFunc(nextTime.Sub(now), cb)
 	return c
 }
+
+type TickerMode int
+
+const (
+	// FixedRate ticks at start + n*d whatever the callback takes, ticks
+	// missed while the goroutine was busy are coalesced into one call
+	FixedRate TickerMode = iota
+	// FixedDelay ticks d after the callback returns
+	FixedDelay
+)
+
+type Ticker struct {
+	t       *Timer
+	d       time.Duration
+	mode    TickerMode
+	start   time.Time
+	n       int64
+	stopped bool
+	cb      func(missed int)
+}
+
+// TickerFunc missed is the number of ticks coalesced into the call, always
+// 0 with FixedDelay
+func (disp *Dispatcher) TickerFunc(d time.Duration, mode TickerMode, cb func(missed int)) *Ticker {
+	if d <= 0 {
+		panic("invalid ticker duration")
+	}
+
+	tk := new(Ticker)
+	tk.d = d
+	tk.mode = mode
+	tk.start = disp.clock.Now()
+	tk.cb = cb
+	tk.t = disp.AfterFunc(d, tk.tick)
+	return tk
+}
+
+func (tk *Ticker) tick() {
+	if tk.mode == FixedDelay {
+		defer func() {
+			// not stopped or reset by cb
+			if !tk.stopped && tk.t.cb == nil {
+				tk.t.Reset(tk.d)
+			}
+		}()
+		tk.cb(0)
+		return
+	}
+
+	now := tk.t.disp.clock.Now()
+	tk.n++
+	missed := 0
+	if late := now.Sub(tk.start.Add(time.Duration(tk.n) * tk.d)); late >= tk.d {
+		missed = int(late / tk.d)
+		tk.n += int64(missed)
+	}
+	tk.t.Reset(tk.start.Add(time.Duration(tk.n+1) * tk.d).Sub(now))
+	tk.cb(missed)
+}
+
+func (tk *Ticker) Stop() {
+	tk.stopped = true
+	tk.t.Stop()
+}
+
+// Reset the ticker restarts now with the period d
+func (tk *Ticker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("invalid ticker duration")
+	}
+
+	tk.d = d
+	tk.start = tk.t.disp.clock.Now()
+	tk.n = 0
+	tk.stopped = false
+	tk.t.Reset(d)
+}
@@ -0,0 +1,234 @@
+package timer
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// hierarchical timing wheel, the same layout as the classic Linux kernel
+// timer wheel: 256 slots of one tick, then 4 levels of 64 slots
+const (
+	wheelRootBits  = 8
+	wheelLevelBits = 6
+	wheelRootSize  = 1 << wheelRootBits
+	wheelLevelSize = 1 << wheelLevelBits
+	wheelRootMask  = wheelRootSize - 1
+	wheelLevelMask = wheelLevelSize - 1
+	wheelLevels    = 4
+	wheelMaxTicks  = 1<<(wheelRootBits+wheelLevels*wheelLevelBits) - 1
+)
+
+type wheel struct {
+	mutex     sync.Mutex
+	clock     Clock
+	tick      time.Duration
+	start     time.Time
+	ticks     uint64 // the next tick to process
+	count     int    // pending timers
+	root      [wheelRootSize]list.List
+	levels    [wheelLevels][wheelLevelSize]list.List
+	chanTimer chan *Timer
+	closed    bool
+	closeCh   chan struct{}
+
+	// wakes the wheel up at tick next, armed only with pending timers
+	driver ClockTimer
+	next   uint64
+	// keeps deliveries in order
+	mutexDeliver sync.Mutex
+}
+
+func newWheel(clock Clock, tick time.Duration, chanTimer chan *Timer) *wheel {
+	w := new(wheel)
+	w.clock = clock
+	w.tick = tick
+	w.start = clock.Now()
+	w.chanTimer = chanTimer
+	w.closeCh = make(chan struct{})
+	return w
+}
+
+func (w *wheel) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.driver != nil {
+		w.driver.Stop()
+		w.driver = nil
+	}
+	close(w.closeCh)
+}
+
+// add the timer to expire on the first tick at or after d from now
+func (w *wheel) add(t *Timer, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := w.clock.Now().Sub(w.start)
+	// an empty wheel skips the idle ticks instead of processing them one by
+	// one on the next fire
+	if w.count == 0 {
+		if ticks := uint64(now / w.tick); ticks > w.ticks {
+			w.ticks = ticks
+		}
+	}
+	t.expires = uint64((now + d + w.tick - 1) / w.tick)
+	w.insert(t)
+	w.count++
+
+	if w.driver == nil || t.expires < w.next {
+		w.arm(t.expires)
+	}
+}
+
+// remove true if the timer was removed before it expired
+func (w *wheel) remove(t *Timer) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if t.slot == nil {
+		return false
+	}
+	t.slot.Remove(t.elem)
+	t.slot = nil
+	t.elem = nil
+	w.count--
+	return true
+}
+
+// arm the driver with w.mutex held
+func (w *wheel) arm(next uint64) {
+	if w.closed {
+		return
+	}
+	if next < w.ticks {
+		next = w.ticks
+	}
+
+	if w.driver != nil {
+		w.driver.Stop()
+	}
+	w.next = next
+	at := w.start.Add(time.Duration(next) * w.tick)
+	w.driver = w.clock.AfterFunc(at.Sub(w.clock.Now()), w.fire)
+}
+
+// the next tick with something to do, with w.mutex held
+func (w *wheel) nextTick() uint64 {
+	if w.ticks&wheelRootMask == 0 {
+		return w.ticks
+	}
+	end := (w.ticks | wheelRootMask) + 1
+	for tick := w.ticks; tick < end; tick++ {
+		if w.root[tick&wheelRootMask].Len() > 0 {
+			return tick
+		}
+	}
+	return end
+}
+
+func (w *wheel) fire() {
+	w.mutexDeliver.Lock()
+	defer w.mutexDeliver.Unlock()
+
+	w.mutex.Lock()
+	w.driver = nil
+	if w.closed {
+		w.mutex.Unlock()
+		return
+	}
+	expired := w.advance(uint64(w.clock.Now().Sub(w.start) / w.tick))
+	if w.count > 0 {
+		w.arm(w.nextTick())
+	}
+	w.mutex.Unlock()
+
+	for _, t := range expired {
+		select {
+		case w.chanTimer <- t:
+		case <-w.closeCh:
+			return
+		}
+	}
+}
+
+// insert with w.mutex held
+func (w *wheel) insert(t *Timer) {
+	var slot *list.List
+
+	expires := t.expires
+	if expires < w.ticks {
+		expires = w.ticks
+	}
+	idx := expires - w.ticks
+	if idx > wheelMaxTicks {
+		idx = wheelMaxTicks
+		expires = w.ticks + idx
+	}
+	if idx < wheelRootSize {
+		slot = &w.root[expires&wheelRootMask]
+	} else {
+		for level := 0; level < wheelLevels; level++ {
+			shift := uint(wheelRootBits + level*wheelLevelBits)
+			if idx < 1<<(shift+wheelLevelBits) || level == wheelLevels-1 {
+				slot = &w.levels[level][(expires>>shift)&wheelLevelMask]
+				break
+			}
+		}
+	}
+
+	t.slot = slot
+	t.elem = slot.PushBack(t)
+}
+
+// cascade moves the timers of a higher level slot down and returns the
+// index of the slot
+func (w *wheel) cascade(level int) uint64 {
+	shift := uint(wheelRootBits + level*wheelLevelBits)
+	idx := (w.ticks >> shift) & wheelLevelMask
+
+	slot := &w.levels[level][idx]
+	for e := slot.Front(); e != nil; {
+		next := e.Next()
+		t := slot.Remove(e).(*Timer)
+		w.insert(t)
+		e = next
+	}
+	return idx
+}
+
+// advance processes all ticks up to target and returns the expired timers,
+// with w.mutex held
+func (w *wheel) advance(target uint64) []*Timer {
+	var expired []*Timer
+	for w.ticks <= target {
+		idx := w.ticks & wheelRootMask
+		if idx == 0 {
+			for level := 0; level < wheelLevels; level++ {
+				if w.cascade(level) != 0 {
+					break
+				}
+			}
+		}
+
+		slot := &w.root[idx]
+		for e := slot.Front(); e != nil; e = slot.Front() {
+			t := slot.Remove(e).(*Timer)
+			t.slot = nil
+			t.elem = nil
+			w.count--
+			expired = append(expired, t)
+		}
+		w.ticks++
+	}
+	return expired
+}